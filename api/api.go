@@ -62,8 +62,51 @@ type Logger interface {
 	Log(context.Context, LogLevel, string)
 }
 
+// requestIDKey is a context.Context value associated with the ID of the
+// current request.
+type requestIDKey struct{}
+
+// WithRequestID returns a context with the ID of the current request, such as
+// from an "X-Request-Id" header. Hosts use it to correlate guest output.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID added by WithRequestID or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
 type Closer interface {
 	// Close releases resources such as any Wasm modules, compiled code, and
 	// the runtime.
 	Close(context.Context) error
 }
+
+// compile-time check to ensure NoopMetrics implements api.Metrics.
+var _ Metrics = NoopMetrics{}
+
+// NoopMetrics is a convenience which ignores all measurements.
+type NoopMetrics struct{}
+
+// RequestHandled implements the same method as documented on api.Metrics.
+func (NoopMetrics) RequestHandled(context.Context) {}
+
+// RequestSkipped implements the same method as documented on api.Metrics.
+func (NoopMetrics) RequestSkipped(context.Context) {}
+
+// Metrics records counters about how the host handles requests.
+//
+// Note: Implementations must be safe for concurrent use.
+type Metrics interface {
+	// RequestHandled is called each time the guest is invoked to handle a
+	// request. It isn't called when the guest can't be instantiated, as the
+	// request fails before reaching it.
+	RequestHandled(context.Context)
+
+	// RequestSkipped is called each time a request is passed to the next
+	// handler without invoking the guest, for example because it didn't
+	// match the configured matchers.
+	RequestSkipped(context.Context)
+}
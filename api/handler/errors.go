@@ -0,0 +1,27 @@
+package handler
+
+import "fmt"
+
+// PanicError is a host error from recovering a panic in the next handler.
+// FuncGetHostError reports it as ErrorKindPanic.
+type PanicError struct {
+	// Value is the value recovered from the panic.
+	Value any
+}
+
+// Error implements error by formatting the recovered value.
+func (e *PanicError) Error() string {
+	return fmt.Sprint(e.Value)
+}
+
+// Unwrap returns the recovered value if it is an error, or nil.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// ErrorKind returns ErrorKindPanic. Hosts can classify their own errors for
+// FuncGetHostError by implementing this method.
+func (e *PanicError) ErrorKind() ErrorKind {
+	return ErrorKindPanic
+}
@@ -48,6 +48,51 @@ const (
 	//
 	// See https://peps.python.org/pep-0444/#request-trailers-and-chunked-transfer-encoding
 	FeatureTrailers
+
+	// FeatureRawHeaders preserves the original casing and wire order of header
+	// names read with FuncGetHeaderNames and FuncGetHeaders. By default, names
+	// are lowercased and in an order defined by the host.
+	//
+	// This is a feature flag because some guests, such as those verifying
+	// AWS SigV4 or HTTP Message Signatures, need the headers as received, but
+	// few hosts can provide them. For example, net/http canonicalizes names and
+	// stores them in a map, so loses both the casing and order.
+	//
+	// A host that doesn't support raw headers must return 0 for this bit in
+	// the FuncEnableFeatures result. A host that does must return names in
+	// the order received, with their original casing.
+	FeatureRawHeaders
+
+	// FeatureQueryCookies allows guests to read and write individual request
+	// query parameters and cookies, via functions such as FuncGetQueryValues
+	// and FuncGetCookieValues. This saves guests the code size and overhead
+	// of parsing FuncGetURI or the "Cookie" header themselves.
+	//
+	// A host that doesn't implement QueryCookiesHost returns 0 for this bit
+	// in the FuncEnableFeatures result. Calling the functions when the
+	// feature isn't enabled panics.
+	FeatureQueryCookies
+
+	// FeatureResponseHeaders calls FuncHandleResponseHeaders before the
+	// response status and headers produced by FuncNext are sent. This allows
+	// the guest to change them without the cost of FeatureBufferResponse, as
+	// the response body is streamed.
+	//
+	// This feature can't be enabled unless the guest exports
+	// FuncHandleResponseHeaders. When FeatureBufferResponse is also enabled,
+	// FuncHandleResponseHeaders isn't called as FuncHandleResponse can
+	// change the buffered response instead.
+	FeatureResponseHeaders
+
+	// FeatureInformational allows guests to send informational (1xx)
+	// responses via FuncSendInformational, such as "103 Early Hints" with
+	// "Link" headers that let clients preload resources before FuncNext
+	// produces the final response.
+	//
+	// A host that doesn't implement InformationalHost returns 0 for this bit
+	// in the FuncEnableFeatures result. Calling FuncSendInformational when the
+	// feature isn't enabled panics.
+	FeatureInformational
 )
 
 // WithEnabled enables the feature or group of features.
@@ -85,6 +130,14 @@ func featureName(f Features) string {
 		return "buffer_response"
 	case FeatureTrailers:
 		return "trailers"
+	case FeatureRawHeaders:
+		return "raw_headers"
+	case FeatureQueryCookies:
+		return "query_cookies"
+	case FeatureResponseHeaders:
+		return "response_headers"
+	case FeatureInformational:
+		return "informational"
 	}
 	return ""
 }
@@ -60,7 +60,11 @@ func TestFeatures_String(t *testing.T) {
 		{name: "buffer_request", feature: FeatureBufferRequest, expected: "buffer_request"},
 		{name: "buffer_response", feature: FeatureBufferResponse, expected: "buffer_response"},
 		{name: "trailers", feature: FeatureTrailers, expected: "trailers"},
-		{name: "all", feature: FeatureBufferRequest | FeatureBufferResponse | FeatureTrailers, expected: "buffer_request|buffer_response|trailers"},
+		{name: "raw_headers", feature: FeatureRawHeaders, expected: "raw_headers"},
+		{name: "query_cookies", feature: FeatureQueryCookies, expected: "query_cookies"},
+		{name: "response_headers", feature: FeatureResponseHeaders, expected: "response_headers"},
+		{name: "informational", feature: FeatureInformational, expected: "informational"},
+		{name: "all", feature: FeatureBufferRequest | FeatureBufferResponse | FeatureTrailers | FeatureRawHeaders | FeatureQueryCookies | FeatureResponseHeaders | FeatureInformational, expected: "buffer_request|buffer_response|trailers|raw_headers|query_cookies|response_headers|informational"},
 		{name: "undefined", feature: 1 << 31, expected: ""},
 	}
 
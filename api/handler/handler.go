@@ -46,7 +46,8 @@ type Host interface {
 
 	// GetRequestHeaderNames supports the WebAssembly function export
 	// FuncGetHeaderNames with HeaderKindRequest. This returns nil if no
-	// headers exist.
+	// headers exist. When FeatureRawHeaders is enabled, names are in the
+	// order received, with their original casing.
 	GetRequestHeaderNames(ctx context.Context) []string
 
 	// GetRequestHeaderValues supports the WebAssembly function export
@@ -66,8 +67,9 @@ type Host interface {
 	// FuncRemoveHeader with HeaderKindRequest.
 	RemoveRequestHeader(ctx context.Context, name string)
 
-	// RequestBodyReader supports the WebAssembly function export
-	// FuncReadBody with BodyKindRequest.
+	// RequestBodyReader supports the WebAssembly function exports
+	// FuncReadBody and FuncPeekBody with BodyKindRequest. The result may
+	// implement BodyPeeker.
 	RequestBodyReader(ctx context.Context) io.ReadCloser
 
 	// RequestBodyWriter supports the WebAssembly function export
@@ -166,6 +168,85 @@ type Host interface {
 	GetSourceAddr(ctx context.Context) string
 }
 
+// HeadersHost is an optional interface a Host can implement to support the
+// WebAssembly function export FuncGetHeaders. When not implemented, the
+// result is derived from the names and values functions of Host, such as
+// Host.GetRequestHeaderNames and Host.GetRequestHeaderValues.
+type HeadersHost interface {
+	// GetHeaders supports the WebAssembly function export FuncGetHeaders. The
+	// result is a flattened sequence of name and value pairs, where a name is
+	// repeated for each of its values. This returns nil if no fields exist
+	// or, for trailers, FeatureTrailers is not supported.
+	GetHeaders(ctx context.Context, kind HeaderKind) []string
+}
+
+// AuthorityHost is an optional interface a Host can implement to support
+// the WebAssembly function exports FuncGetAuthority, FuncSetAuthority,
+// FuncGetScheme and FuncSetScheme, as well as absolute-form in FuncSetURI.
+//
+// When not implemented, the authority is read and written via the "Host"
+// request header, the scheme is empty, and setting the scheme panics.
+type AuthorityHost interface {
+	// GetAuthority supports the WebAssembly function export
+	// FuncGetAuthority.
+	GetAuthority(ctx context.Context) string
+
+	// SetAuthority supports the WebAssembly function export
+	// FuncSetAuthority.
+	SetAuthority(ctx context.Context, authority string)
+
+	// GetScheme supports the WebAssembly function export FuncGetScheme.
+	GetScheme(ctx context.Context) string
+
+	// SetScheme supports the WebAssembly function export FuncSetScheme.
+	SetScheme(ctx context.Context, scheme string)
+}
+
+// BodyPeeker is an optional interface of the io.ReadCloser returned by
+// Host.RequestBodyReader, to support FuncPeekBody without
+// FeatureBufferRequest. When not implemented, peeking the request body
+// requires FeatureBufferRequest.
+type BodyPeeker interface {
+	// PeekAt reads len(p) bytes at offset past what was already read, without
+	// consuming them. Like io.ReaderAt, when n < len(p), err explains why,
+	// such as io.EOF.
+	PeekAt(p []byte, off int64) (n int, err error)
+}
+
+// QueryCookiesHost is an optional interface a Host can implement to support
+// FeatureQueryCookies. When not implemented, the feature can't be enabled.
+type QueryCookiesHost interface {
+	// GetQueryValues supports the WebAssembly function export
+	// FuncGetQueryValues. This returns nil if no values exist.
+	GetQueryValues(ctx context.Context, name string) []string
+
+	// SetQueryValue supports the WebAssembly function export
+	// FuncSetQueryValue.
+	SetQueryValue(ctx context.Context, name, value string)
+
+	// RemoveQuery supports the WebAssembly function export FuncRemoveQuery.
+	RemoveQuery(ctx context.Context, name string)
+
+	// GetCookieValues supports the WebAssembly function export
+	// FuncGetCookieValues. This returns nil if no values exist.
+	GetCookieValues(ctx context.Context, name string) []string
+
+	// SetCookieValue supports the WebAssembly function export
+	// FuncSetCookieValue.
+	SetCookieValue(ctx context.Context, name, value string)
+
+	// RemoveCookie supports the WebAssembly function export FuncRemoveCookie.
+	RemoveCookie(ctx context.Context, name string)
+}
+
+// InformationalHost is an optional interface a Host can implement to support
+// FeatureInformational. When not implemented, the feature can't be enabled.
+type InformationalHost interface {
+	// SendInformational supports the WebAssembly function export
+	// FuncSendInformational. The statusCode is always 1xx, but never 101.
+	SendInformational(ctx context.Context, statusCode uint32)
+}
+
 // eofReader is safer than reading from os.DevNull as it can never overrun
 // operating system file descriptors.
 type eofReader struct{}
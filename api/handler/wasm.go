@@ -75,6 +75,42 @@ type CountLen = uint64
 // Note: `EOF` is not an error, so process `len` bytes returned regardless.
 type EOFLen = uint64
 
+// KindLen is the result of FuncGetHostError. For compatability with
+// WebAssembly Core Specification 1.0, two uint32 values are combined into a
+// single uint64 in the following order:
+//
+//   - kind: the ErrorKind, which is ErrorKindNone if there was no host error.
+//   - len: length of the error message.
+//
+// Here's how to split the results:
+//
+//   - kind: `uint32(kindLen >> 32)`
+//   - len: `uint32(kindLen)`
+//
+// # Examples
+//
+//   - 0 : no host error
+//   - 1<<32|5 (4294967301): the next handler panicked with "oops!"
+type KindLen = uint64
+
+// OffsetLen is the result of FuncInit. For compatability with WebAssembly
+// Core Specification 1.0, two uint32 values are combined into a single uint64
+// in the following order:
+//
+//   - offset: memory offset of an error message.
+//   - len: length of the error message, which is zero on success.
+//
+// Here's how to split the results:
+//
+//   - offset: `uint32(offsetLen >> 32)`
+//   - len: `uint32(offsetLen)`
+//
+// # Examples
+//
+//   - 0 : success
+//   - 1024<<32|14 (4398046511118): failed with the 14 byte message at 1024
+type OffsetLen = uint64
+
 type BodyKind uint32
 
 const (
@@ -132,6 +168,30 @@ const (
 	HeaderKindResponseTrailers HeaderKind = 3
 )
 
+// ErrorKind is the category of a host error producing the response, such as
+// when the next handler fails. See FuncGetHostError.
+type ErrorKind uint32
+
+const (
+	// ErrorKindNone means there was no host error.
+	ErrorKindNone ErrorKind = 0
+
+	// ErrorKindPanic means the next handler panicked. See PanicError.
+	ErrorKindPanic ErrorKind = 1
+
+	// ErrorKindCanceled means the request was canceled, such as when the
+	// client disconnected.
+	ErrorKindCanceled ErrorKind = 2
+
+	// ErrorKindTimeout means a deadline was exceeded, such as a timeout
+	// reading the response from a backend.
+	ErrorKindTimeout ErrorKind = 3
+
+	// ErrorKindUpstream is any other error producing the response, such as a
+	// failure to connect to a backend.
+	ErrorKindUpstream ErrorKind = 4
+)
+
 const (
 	// HostModule is the WebAssembly module name of the ABI this middleware
 	// implements.
@@ -211,6 +271,79 @@ const (
 	// TODO: update
 	FuncHandleResponse = "handle_response"
 
+	// FuncGetHostError writes the message of any host error producing the
+	// response to memory if it isn't larger than BufLimit. The result is
+	// KindLen, which is zero unless called in FuncHandleResponse with
+	// `isError` one.
+	//
+	// The ErrorKind allows guests to map errors to status codes, such as
+	// "504 Gateway Timeout" for ErrorKindTimeout, without parsing messages,
+	// which are host-specific.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetHostError = "get_host_error"
+
+	// FuncIsCanceled returns one if the request was canceled, such as when
+	// the client disconnected or a deadline was exceeded. Otherwise, it
+	// returns zero.
+	//
+	// Hosts may abort a guest when its request is canceled, but guests that
+	// loop for a long time can poll this to stop early and clean up. This is
+	// cheap to call, as it doesn't copy any memory.
+	//
+	// TODO: document on http-wasm-abi
+	FuncIsCanceled = "is_canceled"
+
+	// FuncHandleResponseHeaders is an optional function the host calls when
+	// FeatureResponseHeaders is enabled. It is called once, after the next
+	// handler produced the response status and headers, but before they are
+	// sent. This is only called when FuncHandleRequest returns CtxNext
+	// `next=1`, and before FuncHandleResponse.
+	//
+	// The `reqCtx` parameter is the same as in FuncHandleResponse.
+	//
+	// The guest can read and overwrite the status code and response headers,
+	// but not the response body, which is streamed afterwards.
+	//
+	// TODO: document on http-wasm-abi
+	FuncHandleResponseHeaders = "handle_response_headers"
+
+	// FuncInit is an optional function the host calls once per guest
+	// instance, after it is instantiated and before it handles any request.
+	// This is a better place than `_start` to validate configuration, as it
+	// can fail with a message.
+	//
+	// The result is OffsetLen, which is zero on success. Otherwise, the host
+	// reads the error message from memory, discards the instance and reports
+	// the failure. Request-scoped functions, such as FuncGetHeaderValues,
+	// panic during this call.
+	//
+	// TODO: document on http-wasm-abi
+	FuncInit = "init"
+
+	// FuncShutdown is an optional function the host calls on each idle guest
+	// instance when closing, or when discarding an idle instance before
+	// then, such as to flush state held in memory. This is best-effort: the
+	// host may not call it for instances it is about to discard while
+	// closing. The host may abort it after a deadline, and request-scoped
+	// functions panic during this call.
+	//
+	// TODO: document on http-wasm-abi
+	FuncShutdown = "shutdown"
+
+	// FuncTick is an optional function the host calls periodically, such as
+	// to refill a token bucket or refresh configuration. Ticks are outside
+	// any request, on one instance dedicated to them, so state in its memory
+	// isn't shared with instances handling requests.
+	//
+	// Only FuncGetConfig, FuncLogEnabled, FuncLog and FuncIsCanceled are
+	// available during this call. Others, such as FuncGetHeaderValues, panic.
+	// The host stops ticking when it closes, and may abort a tick in
+	// progress.
+	//
+	// TODO: document on http-wasm-abi
+	FuncTick = "tick"
+
 	// FuncGetMethod writes the method to memory if it isn't larger than
 	// BufLimit. The result is its length in bytes. Ex. "GET"
 	//
@@ -233,12 +366,53 @@ const (
 
 	// FuncSetURI overwrites the URI with one read from memory.
 	//
+	// The URI is usually in origin-form, Ex. "/v1.0/hi?name=panda". It may
+	// also be in absolute-form, Ex. "https://example.com/v1.0/hi", which
+	// additionally overwrites the scheme and authority, as if
+	// FuncSetScheme and FuncSetAuthority were called. A host that can't
+	// change the scheme or authority must panic on absolute-form.
+	//
 	// Note: The URI may include query parameters.
 	//
 	// TODO: update document on http-wasm-abi
 	// See https://github.com/http-wasm/http-wasm-abi/blob/main/http_handler/http_handler.wit.md#set_uri
 	FuncSetURI = "set_uri"
 
+	// FuncGetAuthority writes the request authority to memory if it isn't
+	// larger than BufLimit. The result is its length in bytes.
+	// Ex. "example.com:8080"
+	//
+	// In HTTP/1.1, this is the "Host" header. In HTTP/2.0 and HTTP/3.0, it is
+	// the ":authority" pseudo-header.
+	//
+	// See https://www.rfc-editor.org/rfc/rfc9110#name-host-and-authority
+	// TODO: document on http-wasm-abi
+	FuncGetAuthority = "get_authority"
+
+	// FuncSetAuthority overwrites the request authority with one read from
+	// memory. This is an alternative to FuncSetHeaderValue with the "Host"
+	// header, which works regardless of protocol version.
+	//
+	// TODO: document on http-wasm-abi
+	FuncSetAuthority = "set_authority"
+
+	// FuncGetScheme writes the request scheme to memory if it isn't larger
+	// than BufLimit. The result is its length in bytes. Ex. "https"
+	//
+	// The result is empty when the host can't determine the scheme.
+	//
+	// See https://www.rfc-editor.org/rfc/rfc9110#name-http-related-uri-schemes
+	// TODO: document on http-wasm-abi
+	FuncGetScheme = "get_scheme"
+
+	// FuncSetScheme overwrites the request scheme with one read from memory.
+	// Ex. "https"
+	//
+	// Note: A host that can't change the scheme must panic.
+	//
+	// TODO: document on http-wasm-abi
+	FuncSetScheme = "set_scheme"
+
 	// FuncGetProtocolVersion writes the HTTP protocol version to memory if it
 	// isn't larger than BufLimit. The result is its length in bytes.
 	// Ex. "HTTP/1.1"
@@ -251,6 +425,8 @@ const (
 	// NUL-terminated, to memory if the encoded length isn't larger than
 	// BufLimit. CountLen is returned regardless of whether memory was written.
 	//
+	// Names are lowercased unless FeatureRawHeaders is enabled.
+	//
 	// TODO: document on http-wasm-abi
 	FuncGetHeaderNames = "get_header_names"
 
@@ -261,6 +437,25 @@ const (
 	// TODO: document on http-wasm-abi
 	FuncGetHeaderValues = "get_header_values"
 
+	// FuncGetHeaders writes all fields of the given HeaderKind to memory if
+	// the encoded length isn't larger than BufLimit. Each field is written as
+	// its NUL-terminated name followed by its NUL-terminated value, and a name
+	// with multiple values is repeated for each value. Ex.
+	// "accept\0*/*\0set-cookie\0a=b\0set-cookie\0c=d\0"
+	//
+	// The result is CountLen, where count is the number of NUL-terminated
+	// strings, so twice the number of fields. CountLen is returned regardless
+	// of whether memory was written.
+	//
+	// This is an alternative to calling FuncGetHeaderNames and then
+	// FuncGetHeaderValues for each name, which is expensive for guests that
+	// need all fields, such as logging or signing handlers.
+	//
+	// Names are lowercased unless FeatureRawHeaders is enabled.
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetHeaders = "get_headers"
+
 	// FuncSetHeaderValue overwrites all values of the given HeaderKind and name
 	// with the input.
 	//
@@ -278,6 +473,56 @@ const (
 	// TODO: document on http-wasm-abi
 	FuncRemoveHeader = "remove_header"
 
+	// FuncGetQueryValues writes all values of the given request query
+	// parameter name, decoded and NUL-terminated, to memory if the encoded
+	// length isn't larger than BufLimit. CountLen is returned regardless of
+	// whether memory was written. This requires FeatureQueryCookies.
+	//
+	// For example, given the URI "/search?tag=a&tag=b%20c", the values of
+	// "tag" are "a\0b c\0".
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetQueryValues = "get_query_values"
+
+	// FuncSetQueryValue overwrites all values of the given request query
+	// parameter name with the input, which is encoded by the host. This
+	// requires FeatureQueryCookies.
+	//
+	// TODO: document on http-wasm-abi
+	FuncSetQueryValue = "set_query_value"
+
+	// FuncRemoveQuery removes any values of the given request query
+	// parameter name. This requires FeatureQueryCookies.
+	//
+	// TODO: document on http-wasm-abi
+	FuncRemoveQuery = "remove_query"
+
+	// FuncGetCookieValues writes all values of the given request cookie name,
+	// NUL-terminated, to memory if the encoded length isn't larger than
+	// BufLimit. CountLen is returned regardless of whether memory was written.
+	// This requires FeatureQueryCookies.
+	//
+	// For example, given the "Cookie" header "a=b; c=d", the values of "c"
+	// are "d\0".
+	//
+	// TODO: document on http-wasm-abi
+	FuncGetCookieValues = "get_cookie_values"
+
+	// FuncSetCookieValue overwrites all values of the given request cookie
+	// name with the input. This requires FeatureQueryCookies.
+	//
+	// Note: This changes the request "Cookie" header, not the response
+	// "Set-Cookie" header.
+	//
+	// TODO: document on http-wasm-abi
+	FuncSetCookieValue = "set_cookie_value"
+
+	// FuncRemoveCookie removes any values of the given request cookie name.
+	// This requires FeatureQueryCookies.
+	//
+	// TODO: document on http-wasm-abi
+	FuncRemoveCookie = "remove_cookie"
+
 	// FuncReadBody reads up to BufLimit bytes remaining in the BodyKind body
 	// into memory at offset `buf`. A zero BufLimit will panic.
 	//
@@ -288,9 +533,32 @@ const (
 	// reads what's remaining in the stream, as opposed to starting from zero.
 	// Callers do not have to exhaust the stream until `EOF`.
 	//
+	// Note: Reading the request body of a request with the header "Expect:
+	// 100-continue" signals the client to send it, so guests that may reject
+	// the request, such as for authorization, should do so before reading.
+	// Hosts don't touch the request body until it is read.
+	//
 	// TODO: document on http-wasm-abi
 	FuncReadBody = "read_body"
 
+	// FuncPeekBody reads up to BufLimit bytes of the BodyKind body into
+	// memory at offset `buf`, without consuming them. A zero BufLimit will
+	// panic.
+	//
+	// The `offset` parameter is the count of bytes to skip, relative to what
+	// FuncReadBody already read. The result is EOFLen, where EOF means the
+	// body ends before `offset` plus BufLimit.
+	//
+	// Unlike FuncReadBody, the bytes peeked remain to be read by
+	// FuncReadBody, and by the next handler. Hosts only buffer the bytes
+	// peeked, unless FeatureBufferRequest is enabled.
+	//
+	// Note: Like FuncReadBody, peeking the request body of a request with the
+	// header "Expect: 100-continue" signals the client to send it.
+	//
+	// TODO: document on http-wasm-abi
+	FuncPeekBody = "peek_body"
+
 	// FuncWriteBody reads `buf_len` bytes at memory offset `buf` and writes
 	// them to the pending BodyKind body.
 	//
@@ -317,6 +585,19 @@ const (
 	// TODO: document on http-wasm-abi
 	FuncSetStatusCode = "set_status_code"
 
+	// FuncSendInformational sends an informational (1xx) response with the
+	// given status code and the current response headers, such as "103 Early
+	// Hints". This requires FeatureInformational. Status codes outside 1xx,
+	// and "101 Switching Protocols", panic.
+	//
+	// This can be called any number of times before the final response is
+	// sent: before FuncNext, or after it when FeatureBufferResponse is
+	// enabled. The response headers are not reset afterwards, so remove any
+	// that shouldn't be in the final response.
+	//
+	// TODO: document on http-wasm-abi
+	FuncSendInformational = "send_informational"
+
 	// FuncGetSourceAddr writes the SourceAddr to memory if it isn't larger than BufLimit.
 	// The result is its length in bytes. Ex. "1.1.1.1:12345" or "[fe80::101e:2bdf:8bfb:b97e]:12345"
 	//
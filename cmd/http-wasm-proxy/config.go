@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
+)
+
+// config is the configuration file of the proxy, in JSON or YAML.
+type config struct {
+	// CacheDir is where guests fetched by URL are cached, if set.
+	CacheDir string `json:"cache_dir"`
+
+	// Upstreams are the base URLs of backends, by name.
+	Upstreams map[string]string `json:"upstreams"`
+
+	// Listeners are the addresses to serve, and their routes.
+	Listeners []listenerConfig `json:"listeners"`
+}
+
+// listenerConfig is an address to serve, such as ":8080".
+type listenerConfig struct {
+	Addr string `json:"addr"`
+
+	// Routes are matched in order. Requests matching no route get a 404.
+	Routes []routeConfig `json:"routes"`
+}
+
+// routeConfig proxies matching requests to an upstream through guests.
+type routeConfig struct {
+	// Host matches the request host, ignoring port. Empty matches any.
+	Host string `json:"host"`
+
+	// PathPrefix matches the start of the request path. Empty matches any.
+	PathPrefix string `json:"path_prefix"`
+
+	// Upstream is the name of the upstream to proxy to.
+	Upstream string `json:"upstream"`
+
+	// Guests handle the request in order, the last calling the upstream.
+	Guests []guestConfig `json:"guests"`
+}
+
+// guestConfig is a guest in the chain of a route.
+type guestConfig struct {
+	// Guest is a loader.Loader reference, such as a file path or URL.
+	Guest string `json:"guest"`
+
+	// Config is passed to the guest. A JSON string is passed unquoted, and
+	// any other JSON value as-is.
+	Config json.RawMessage `json:"config"`
+
+	// Features are names of the features the guest can enable, such as
+	// "buffer_request". When absent, the guest can enable any feature.
+	Features []string `json:"features"`
+}
+
+// readConfig reads and validates the configuration file at path. Files with
+// a ".yaml" or ".yml" extension are YAML, and any others are JSON.
+func readConfig(path string) (*config, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// Convert to JSON, so that "config" is read as a json.RawMessage.
+		if b, err = yaml.YAMLToJSON(b); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", path, err)
+		}
+	}
+	var c config
+	if err = json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if err = c.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+func (c *config) validate() error {
+	for name, rawURL := range c.Upstreams {
+		if u, err := url.Parse(rawURL); err != nil {
+			return fmt.Errorf("upstream %s: %w", name, err)
+		} else if u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("upstream %s: URL %q isn't absolute", name, rawURL)
+		}
+	}
+	if len(c.Listeners) == 0 {
+		return fmt.Errorf("no listeners")
+	}
+	addrs := map[string]struct{}{}
+	for _, l := range c.Listeners {
+		if _, ok := addrs[l.Addr]; ok {
+			return fmt.Errorf("listener %q: duplicate addr", l.Addr)
+		}
+		addrs[l.Addr] = struct{}{}
+		for i, r := range l.Routes {
+			if _, ok := c.Upstreams[r.Upstream]; !ok {
+				return fmt.Errorf("listener %q route %d: unknown upstream %q", l.Addr, i, r.Upstream)
+			}
+			for j, g := range r.Guests {
+				if g.Guest == "" {
+					return fmt.Errorf("listener %q route %d guest %d: missing guest", l.Addr, i, j)
+				}
+				if _, err := g.allowedFeatures(); err != nil {
+					return fmt.Errorf("listener %q route %d guest %d: %w", l.Addr, i, j, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// guestConfig returns the configuration to pass to the guest.
+func (g *guestConfig) guestConfig() ([]byte, error) {
+	if len(g.Config) > 0 && g.Config[0] == '"' {
+		var s string
+		if err := json.Unmarshal(g.Config, &s); err != nil {
+			return nil, err
+		}
+		return []byte(s), nil
+	}
+	return g.Config, nil
+}
+
+// allowedFeatures returns the features named by Features, or nil if there is
+// no restriction.
+func (g *guestConfig) allowedFeatures() (*handler.Features, error) {
+	if g.Features == nil {
+		return nil, nil
+	}
+	var features handler.Features
+	for _, name := range g.Features {
+		feature, ok := featureNamed(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown feature %q", name)
+		}
+		features = features.WithEnabled(feature)
+	}
+	return &features, nil
+}
+
+// featureNamed returns the feature with the name returned by
+// handler.Features String.
+func featureNamed(name string) (handler.Features, bool) {
+	if name == "" {
+		return 0, false
+	}
+	for i := 0; i <= 31; i++ {
+		if f := handler.Features(1 << i); f.String() == name {
+			return f, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,128 @@
+// Command http-wasm-proxy is a reverse proxy that runs chains of http-wasm
+// guests in front of upstreams, configured by a JSON file:
+//
+//	http-wasm-proxy -config proxy.json
+//
+// The file is read as YAML instead when its extension is ".yaml" or ".yml".
+//
+// The configuration lists upstreams by name, and the routes of each listener.
+// Requests match the first route by host and path prefix, then are handled
+// by its guests in order before being proxied to its upstream. For example:
+//
+//	{
+//	  "cache_dir": "/var/cache/http-wasm",
+//	  "upstreams": {"app": "http://localhost:9000"},
+//	  "listeners": [{
+//	    "addr": ":8080",
+//	    "routes": [{
+//	      "path_prefix": "/api/",
+//	      "upstream": "app",
+//	      "guests": [{
+//	        "guest": "https://example.com/auth.wasm@sha256:...",
+//	        "config": {"realm": "api"},
+//	        "features": ["buffer_request"]
+//	      }]
+//	    }]
+//	  }]
+//	}
+//
+// Guests are loaded with the loader package, so can be paths, URLs or OCI
+// layouts. "config" is passed to the guest: a JSON string as its contents,
+// and any other value as JSON. When set, "features" restricts the features
+// the guest can enable to those named.
+//
+// Sending SIGHUP reloads the configuration, leaving the current one in place
+// if the new one is invalid. Requests in flight finish with the guests they
+// started with. Listener addresses can only change on restart.
+//
+// # TCK
+//
+// To check the proxy against the http-wasm TCK, route a listener through
+// the TCK guest (tck/tck.wasm) to a backend started with tck.StartBackend,
+// then point tck.Run at the listener with tck.RemoteBackend. TestTCK does
+// this on each test run.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/http-wasm/http-wasm-host-go/api"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+// run runs the proxy until SIGINT or SIGTERM, returning the exit code.
+func run(args []string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("http-wasm-proxy", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "JSON or YAML configuration file")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *configPath == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	ctx := context.Background()
+	p, err := newProxy(ctx, *configPath, api.ConsoleLogger{})
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	defer p.close(ctx)
+
+	errs := make(chan error, len(p.addrs()))
+	servers := make([]*http.Server, 0, len(p.addrs()))
+	for _, addr := range p.addrs() {
+		s := &http.Server{Addr: addr, Handler: p.handler(addr), ReadHeaderTimeout: 10 * time.Second}
+		servers = append(servers, s)
+		go func() {
+			if err := s.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				errs <- err
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	code := 0
+loop:
+	for {
+		select {
+		case err = <-errs:
+			fmt.Fprintln(stderr, err)
+			code = 1
+			break loop
+		case sig := <-signals:
+			if sig != syscall.SIGHUP {
+				break loop
+			}
+			if err = p.reload(ctx); err != nil {
+				fmt.Fprintln(stderr, "reload failed:", err)
+			} else {
+				fmt.Fprintln(stderr, "reloaded", *configPath)
+			}
+		}
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	for _, s := range servers {
+		_ = s.Shutdown(shutdownCtx)
+	}
+	return code
+}
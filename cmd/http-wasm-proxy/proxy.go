@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/http-wasm/http-wasm-host-go/api"
+	"github.com/http-wasm/http-wasm-host-go/handler"
+	wasm "github.com/http-wasm/http-wasm-host-go/handler/nethttp"
+	"github.com/http-wasm/http-wasm-host-go/loader"
+)
+
+// proxy serves the routes of the current configuration, which is replaced on
+// reload.
+type proxy struct {
+	configPath string
+	logger     api.Logger
+	current    atomic.Pointer[generation]
+
+	// closing tracks generations replaced by reload that are still closing.
+	closing sync.WaitGroup
+}
+
+// newProxy loads the configuration file at configPath.
+func newProxy(ctx context.Context, configPath string, logger api.Logger) (*proxy, error) {
+	p := &proxy{configPath: configPath, logger: logger}
+	if err := p.reload(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// addrs returns the listener addresses of the current configuration.
+func (p *proxy) addrs() []string {
+	return p.current.Load().addrs
+}
+
+// reload replaces the current configuration with the file at configPath.
+// On error, the current configuration is kept. Listener addresses can't
+// change, as their servers are already listening.
+func (p *proxy) reload(ctx context.Context) error {
+	c, err := readConfig(p.configPath)
+	if err != nil {
+		return err
+	}
+	next, err := newGeneration(ctx, c, p.logger)
+	if err != nil {
+		return err
+	}
+	prev := p.current.Load()
+	if prev != nil && strings.Join(prev.addrs, ",") != strings.Join(next.addrs, ",") {
+		next.close(ctx)
+		return fmt.Errorf("listener addrs changed from %v to %v: restart to apply", prev.addrs, next.addrs)
+	}
+	p.current.Store(next)
+	if prev != nil {
+		// Closing waits for in-flight requests, so do it in the background to
+		// not block the caller, such as the loop handling signals.
+		p.closing.Add(1)
+		go func() {
+			defer p.closing.Done()
+			prev.close(ctx)
+		}()
+	}
+	return nil
+}
+
+// handler returns the handler of the listener at addr.
+func (p *proxy) handler(addr string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for {
+			g := p.current.Load()
+			if g.serveHTTP(addr, w, r) {
+				return
+			}
+			// g was closed after Load, so retry with its replacement.
+		}
+	})
+}
+
+// close closes the guests of the current configuration, after waiting for
+// those of previous ones to close.
+func (p *proxy) close(ctx context.Context) {
+	p.closing.Wait()
+	p.current.Load().close(ctx)
+}
+
+// generation is the guests and routes of a configuration.
+type generation struct {
+	// mu is held for reading by requests, so close can wait for them.
+	mu     sync.RWMutex
+	closed bool
+
+	addrs       []string
+	routes      map[string][]route // by listener addr
+	middlewares []wasm.Middleware
+}
+
+// route is a routeConfig with its guest chain.
+type route struct {
+	host, pathPrefix string
+	handler          http.Handler
+}
+
+func newGeneration(ctx context.Context, c *config, logger api.Logger) (*generation, error) {
+	g := &generation{routes: map[string][]route{}}
+
+	upstreams := make(map[string]http.Handler, len(c.Upstreams))
+	for name, rawURL := range c.Upstreams {
+		u, _ := url.Parse(rawURL) // validated by readConfig
+		upstreams[name] = httputil.NewSingleHostReverseProxy(u)
+	}
+
+	l := &loader.Loader{CacheDir: c.CacheDir}
+	for _, lc := range c.Listeners {
+		g.addrs = append(g.addrs, lc.Addr)
+		for i, rc := range lc.Routes {
+			h := upstreams[rc.Upstream]
+			// Wrap in reverse, so that the first guest handles the request
+			// first.
+			for j := len(rc.Guests) - 1; j >= 0; j-- {
+				var err error
+				if h, err = g.newHandler(ctx, l, &rc.Guests[j], logger, h); err != nil {
+					g.close(ctx)
+					return nil, fmt.Errorf("listener %q route %d guest %d: %w", lc.Addr, i, j, err)
+				}
+			}
+			g.routes[lc.Addr] = append(g.routes[lc.Addr], route{
+				host:       rc.Host,
+				pathPrefix: rc.PathPrefix,
+				handler:    h,
+			})
+		}
+	}
+	return g, nil
+}
+
+// newHandler loads the guest, returning a handler that calls next.
+func (g *generation) newHandler(ctx context.Context, l *loader.Loader, gc *guestConfig, logger api.Logger, next http.Handler) (http.Handler, error) {
+	guest, err := l.Load(ctx, gc.Guest)
+	if err != nil {
+		return nil, err
+	}
+	guestConfig, err := gc.guestConfig()
+	if err != nil {
+		return nil, err
+	}
+	options := []handler.Option{handler.GuestConfig(guestConfig), handler.Logger(logger)}
+	if features, _ := gc.allowedFeatures(); features != nil { // validated by readConfig
+		options = append(options, handler.AllowFeatures(*features))
+	}
+	mw, err := wasm.NewMiddleware(ctx, guest, options...)
+	if err != nil {
+		return nil, err
+	}
+	g.middlewares = append(g.middlewares, mw)
+	return mw.NewHandler(ctx, next), nil
+}
+
+// serveHTTP serves the request with the first matching route of the listener
+// at addr. This returns false without serving if the generation is closed.
+func (g *generation) serveHTTP(addr string, w http.ResponseWriter, r *http.Request) bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if g.closed {
+		return false
+	}
+
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, rt := range g.routes[addr] {
+		if rt.host != "" && !strings.EqualFold(rt.host, host) {
+			continue
+		}
+		if !strings.HasPrefix(r.URL.Path, rt.pathPrefix) {
+			continue
+		}
+		rt.handler.ServeHTTP(w, r)
+		return true
+	}
+	http.NotFound(w, r)
+	return true
+}
+
+// close waits for in-flight requests, then closes the guests.
+func (g *generation) close(ctx context.Context) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return
+	}
+	g.closed = true
+	for _, mw := range g.middlewares {
+		_ = mw.Close(ctx)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/http-wasm/http-wasm-host-go/api"
+	"github.com/http-wasm/http-wasm-host-go/tck"
+)
+
+// TestTCK runs the TCK through the proxy, routing a listener through the
+// TCK guest to the TCK backend.
+func TestTCK(t *testing.T) {
+	backend := httptest.NewServer(tck.BackendHandler())
+	defer backend.Close()
+
+	dir := t.TempDir()
+	guestPath := filepath.Join(dir, "tck.wasm")
+	if err := os.WriteFile(guestPath, tck.GuestWASM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	configPath := filepath.Join(dir, "proxy.json")
+	config := `{
+  "upstreams": {"backend": "` + backend.URL + `"},
+  "listeners": [{
+    "addr": "` + testAddr + `",
+    "routes": [{"upstream": "backend", "guests": [{"guest": "` + guestPath + `"}]}]
+  }]
+}`
+	if err := os.WriteFile(configPath, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := newProxy(testCtx, configPath, api.NoopLogger{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.close(testCtx)
+
+	ts := httptest.NewServer(p.handler(testAddr))
+	defer ts.Close()
+
+	// The backend runs in another server, so its panics don't reach the proxy.
+	tck.Run(t, ts.Client(), ts.URL, tck.RemoteBackend())
+}
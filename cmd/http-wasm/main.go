@@ -0,0 +1,314 @@
+// Command http-wasm includes tools for http-wasm guests.
+//
+// To validate a guest before deploying it, run:
+//
+//	http-wasm validate guest.wasm
+//
+// This prints the result as JSON, exiting non-zero if the guest is invalid.
+//
+// To check how a guest handles recorded traffic, run:
+//
+//	http-wasm replay guest.wasm traffic.har
+//
+// Traffic is a HAR file, or JSON lines as read by replay.ReadJSONL, which can
+// include expectations. Each exchange is served by the guest, with a backend
+// returning the recorded response. This prints a JSON line per exchange,
+// with the guest's effects on it, and exits non-zero if an expectation isn't
+// met. With "-against previous.wasm", this also diffs the guest against the
+// other, exiting non-zero if they differ.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
+	wasm "github.com/http-wasm/http-wasm-host-go/handler"
+	nethttp "github.com/http-wasm/http-wasm-host-go/handler/nethttp"
+	"github.com/http-wasm/http-wasm-host-go/replay"
+)
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdout, os.Stderr))
+}
+
+const usage = `usage: http-wasm <command> [arguments]
+
+commands:
+  validate [-config <file>] <guest.wasm>
+  replay [-config <file>] [-against <other.wasm>] <guest.wasm> <traffic.har|traffic.jsonl>
+`
+
+// run runs the command in args, returning the exit code.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	switch args[0] {
+	case "validate":
+		return runValidate(ctx, args[1:], stdout, stderr)
+	case "replay":
+		return runReplay(ctx, args[1:], stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+}
+
+func runValidate(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "file with the guest configuration")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	guest, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	var guestConfig []byte
+	if *configPath != "" {
+		if guestConfig, err = os.ReadFile(*configPath); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+
+	result := validate(ctx, guest, guestConfig)
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "  ")
+	if err = enc.Encode(result); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	if !result.Valid {
+		return 1
+	}
+	return 0
+}
+
+// validation is the JSON result of the validate command.
+type validation struct {
+	// Valid is true if the middleware can load the guest.
+	Valid bool `json:"valid"`
+
+	// Error is why the guest is invalid, if it isn't.
+	Error string `json:"error,omitempty"`
+
+	// Imports are the functions imported by the guest, grouped by module:
+	// "http_handler", "wasi_snapshot_preview1" or "unknown". Unknown imports
+	// are formatted as "module.name".
+	Imports map[string][]string `json:"imports"`
+
+	// Features are those the guest enabled while initializing.
+	Features []string `json:"features"`
+}
+
+// validate runs the same checks as loading the guest into the middleware,
+// recording the features it enables while initializing.
+func validate(ctx context.Context, guest, guestConfig []byte) *validation {
+	result := &validation{Imports: map[string][]string{}, Features: []string{}}
+
+	// Compile separately to list imports, even if the guest is invalid.
+	r := wazero.NewRuntime(ctx)
+	defer r.Close(ctx)
+	compiled, err := r.CompileModule(ctx, guest)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	for _, f := range compiled.ImportedFunctions() {
+		moduleName, name, _ := f.Import()
+		switch moduleName {
+		case handler.HostModule, wasi_snapshot_preview1.ModuleName:
+			result.Imports[moduleName] = append(result.Imports[moduleName], name)
+		default:
+			result.Imports["unknown"] = append(result.Imports["unknown"], moduleName+"."+name)
+		}
+	}
+	for _, names := range result.Imports {
+		sort.Strings(names)
+	}
+
+	host := &recordingHost{}
+	mw, err := wasm.NewMiddleware(ctx, guest, host, wasm.GuestConfig(guestConfig))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer mw.Close(ctx)
+
+	result.Valid = true
+	if features := host.features.String(); features != "" {
+		result.Features = strings.Split(features, "|")
+	}
+	return result
+}
+
+var (
+	_ handler.QueryCookiesHost  = (*recordingHost)(nil)
+	_ handler.InformationalHost = (*recordingHost)(nil)
+)
+
+// recordingHost records the features the guest enables, allowing all of
+// them. It implements the optional interfaces, so that no feature is masked.
+type recordingHost struct {
+	handler.UnimplementedHost
+	features handler.Features
+}
+
+func (*recordingHost) GetQueryValues(context.Context, string) []string  { return nil }
+func (*recordingHost) SetQueryValue(context.Context, string, string)    {}
+func (*recordingHost) RemoveQuery(context.Context, string)              {}
+func (*recordingHost) GetCookieValues(context.Context, string) []string { return nil }
+func (*recordingHost) SetCookieValue(context.Context, string, string)   {}
+func (*recordingHost) RemoveCookie(context.Context, string)             {}
+func (*recordingHost) SendInformational(context.Context, uint32)        {}
+
+// EnableFeatures implements the same method as documented on handler.Host.
+func (h *recordingHost) EnableFeatures(_ context.Context, features handler.Features) handler.Features {
+	h.features = h.features.WithEnabled(features)
+	return h.features
+}
+
+func runReplay(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configPath := flags.String("config", "", "file with the guest configuration")
+	againstPath := flags.String("against", "", "other version of the guest to diff against")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 2 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	var guestConfig []byte
+	if *configPath != "" {
+		var err error
+		if guestConfig, err = os.ReadFile(*configPath); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+	exchanges, err := readTraffic(flags.Arg(1))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	results, err := replayGuest(ctx, flags.Arg(0), guestConfig, exchanges)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	var against []replay.Result
+	if *againstPath != "" {
+		if against, err = replayGuest(ctx, *againstPath, guestConfig, exchanges); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+
+	code := 0
+	enc := json.NewEncoder(stdout)
+	for i := range exchanges {
+		ex, result := &exchanges[i], &results[i]
+		line := &replayed{
+			Index:   i,
+			Method:  ex.Request.Method,
+			URL:     ex.Request.URL,
+			Next:    result.Next,
+			Effects: replay.Effects(ex, result),
+		}
+		if line.Effects == nil {
+			line.Effects = []replay.Change{}
+		}
+		if against != nil {
+			line.Differences = replay.Diff(&against[i], result)
+		}
+		if ex.Expected != nil {
+			line.Failures = replay.Check(ex.Expected, result)
+		}
+		if len(line.Differences) > 0 || len(line.Failures) > 0 {
+			code = 1
+		}
+		if err = enc.Encode(line); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+	return code
+}
+
+// replayed is the JSON line of the replay command for each exchange.
+type replayed struct {
+	// Index is the position of the exchange in the traffic file.
+	Index  int    `json:"index"`
+	Method string `json:"method"`
+	URL    string `json:"url"`
+
+	// Next is true if the guest called the backend.
+	Next bool `json:"next"`
+
+	// Effects are how the guest changed the exchange.
+	Effects []replay.Change `json:"effects"`
+
+	// Differences are versus the guest passed to -against, if any.
+	Differences []replay.Change `json:"differences,omitempty"`
+
+	// Failures are expectations of the exchange the guest didn't meet.
+	Failures []replay.Change `json:"failures,omitempty"`
+}
+
+// readTraffic reads a HAR file, if its extension is ".har", or JSON lines.
+func readTraffic(path string) ([]replay.Exchange, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var exchanges []replay.Exchange
+	if strings.EqualFold(filepath.Ext(path), ".har") {
+		exchanges, err = replay.ReadHAR(f)
+	} else {
+		exchanges, err = replay.ReadJSONL(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid traffic %s: %w", path, err)
+	}
+	return exchanges, nil
+}
+
+// replayGuest replays the exchanges through the guest at path.
+func replayGuest(ctx context.Context, path string, guestConfig []byte, exchanges []replay.Exchange) ([]replay.Result, error) {
+	guest, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mw, err := nethttp.NewMiddleware(ctx, guest, wasm.GuestConfig(guestConfig))
+	if err != nil {
+		return nil, err
+	}
+	defer mw.Close(ctx)
+	return replay.Run(ctx, mw, exchanges)
+}
@@ -0,0 +1,25 @@
+;; features enables features on start, which validate reports.
+(module $features
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "get_uri" (func $get_uri
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  ;; enable buffer_request and query_cookies
+  (func $main
+    (drop (call $enable_features (i32.or (i32.const 1) (i32.const 16)))))
+  (start $main)
+
+  ;; handle_request calls the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (return (i64.const 1)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
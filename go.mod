@@ -2,4 +2,9 @@ module github.com/http-wasm/http-wasm-host-go
 
 go 1.21
 
-require github.com/tetratelabs/wazero v1.8.0
+require (
+	github.com/andybalholm/brotli v1.1.1
+	github.com/klauspost/compress v1.17.11
+	github.com/tetratelabs/wazero v1.8.0
+	sigs.k8s.io/yaml v1.4.0
+)
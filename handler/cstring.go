@@ -45,3 +45,41 @@ func writeNULTerminated(
 	}
 	return
 }
+
+// writeNULTerminatedLower is like writeNULTerminated, except it writes every
+// stride-th string, starting with the first, in lowercase. This avoids
+// allocating lowercase copies of header names.
+//
+// Ex. stride one lowercases all header names, while stride two lowercases
+// only the names in a sequence of header name and value pairs.
+func writeNULTerminatedLower(
+	ctx context.Context,
+	mem wazeroapi.Memory,
+	buf uint32, bufLimit handler.BufLimit,
+	input []string, stride int,
+) (countLen handler.CountLen) {
+	countLen = writeNULTerminated(ctx, mem, buf, bufLimit, input)
+	if byteCount := uint32(countLen); countLen == 0 || byteCount > bufLimit {
+		return // nothing was written
+	}
+
+	// Lowercase the strings in memory, which was written above.
+	s, _ := mem.Read(buf, uint32(countLen))
+	for i, v := range input {
+		if i%stride == 0 {
+			lowerASCII(s[:len(v)])
+		}
+		s = s[len(v)+1:] // skip the NUL terminator
+	}
+	return
+}
+
+// lowerASCII lowercases b in place. This is safe for header names, which are
+// tokens limited to US-ASCII.
+func lowerASCII(b []byte) {
+	for i, c := range b {
+		if 'A' <= c && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+}
@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/http-wasm/http-wasm-host-go/api"
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
+)
+
+// ContentEncodingPolicy defines what happens to the "Content-Encoding" of a
+// body the guest reads decoded, when it also writes that body. See
+// DecodeContent.
+type ContentEncodingPolicy uint8
+
+const (
+	// ContentEncodingReencode encodes bodies written by the guest with the
+	// same "Content-Encoding" they had when read.
+	ContentEncodingReencode ContentEncodingPolicy = iota + 1
+
+	// ContentEncodingDrop writes bodies as-is, removing the
+	// "Content-Encoding" header.
+	ContentEncodingDrop
+)
+
+// contentDecoders are the "Content-Encoding" values DecodeContent supports.
+// Bodies with other encodings, or with more than one, are read as-is, which
+// is logged as a warning.
+var contentDecoders = map[string]struct {
+	newReader func(io.Reader) (io.ReadCloser, error)
+	newWriter func(io.Writer) io.WriteCloser
+}{
+	"gzip": {
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		newWriter: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+	},
+	"x-gzip": {
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+		newWriter: func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+	},
+	// "deflate" in HTTP means the zlib format, not raw deflate (RFC 9110).
+	"deflate": {
+		newReader: zlib.NewReader,
+		newWriter: func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+	},
+	"br": {
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(brotli.NewReader(r)), nil },
+		newWriter: func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+	},
+	"zstd": {
+		newReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r)
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+		newWriter: func(w io.Writer) io.WriteCloser {
+			e, _ := zstd.NewWriter(w) // only errs on invalid options
+			return e
+		},
+	},
+}
+
+// contentEncoding returns the supported "Content-Encoding" of the body kind
+// or an empty string. unsupported is the header value otherwise, if any.
+func (m *middleware) contentEncoding(ctx context.Context, kind handler.BodyKind) (encoding, unsupported string) {
+	if m.contentDecoding == 0 {
+		return "", ""
+	}
+	var values []string
+	switch kind {
+	case handler.BodyKindRequest:
+		values = m.host.GetRequestHeaderValues(ctx, "Content-Encoding")
+	case handler.BodyKindResponse:
+		values = m.host.GetResponseHeaderValues(ctx, "Content-Encoding")
+	}
+	if len(values) == 0 {
+		return "", ""
+	} else if len(values) > 1 { // layered encodings
+		return "", strings.Join(values, ", ")
+	}
+	encoding = strings.ToLower(strings.TrimSpace(values[0]))
+	if _, ok := contentDecoders[encoding]; !ok {
+		return "", values[0]
+	}
+	return encoding, ""
+}
+
+// decodeBody returns a reader of the decoded body, if the body kind has a
+// supported "Content-Encoding". Otherwise, it returns the input.
+func (m *middleware) decodeBody(ctx context.Context, kind handler.BodyKind, r io.ReadCloser) io.ReadCloser {
+	encoding, unsupported := m.contentEncoding(ctx, kind)
+	if unsupported != "" {
+		name := "request"
+		if kind == handler.BodyKindResponse {
+			name = "response"
+		}
+		m.logger.Log(ctx, api.LogLevelWarn, fmt.Sprintf("guest reads the %s body as-is, as its Content-Encoding %q isn't supported", name, unsupported))
+	}
+	if encoding == "" {
+		return r
+	}
+	return &decodingReader{delegate: r, newReader: contentDecoders[encoding].newReader}
+}
+
+// encodeBody returns a writer that handles the body kind's "Content-Encoding"
+// according to the ContentEncodingPolicy. This also removes any
+// "Content-Length" as the written body will have a different length.
+func (m *middleware) encodeBody(ctx context.Context, kind handler.BodyKind, w io.Writer) io.Writer {
+	encoding, _ := m.contentEncoding(ctx, kind)
+	if encoding == "" {
+		return w
+	}
+
+	var removeHeader func(ctx context.Context, name string)
+	switch kind {
+	case handler.BodyKindRequest:
+		removeHeader = m.host.RemoveRequestHeader
+	case handler.BodyKindResponse:
+		removeHeader = m.host.RemoveResponseHeader
+	}
+	removeHeader(ctx, "Content-Length")
+
+	if m.contentDecoding == ContentEncodingDrop {
+		removeHeader(ctx, "Content-Encoding")
+		return w
+	}
+	return &encodingWriter{WriteCloser: contentDecoders[encoding].newWriter(w), delegate: w}
+}
+
+// decodingReader lazily decodes the delegate, as decoders like gzip read a
+// header on creation.
+//
+// This doesn't implement handler.BodyPeeker, even if the delegate does, as
+// decoders read ahead of what they return. Hence, peeking a decoded request
+// body requires handler.FeatureBufferRequest.
+type decodingReader struct {
+	delegate  io.ReadCloser
+	newReader func(io.Reader) (io.ReadCloser, error)
+	decoder   io.ReadCloser
+}
+
+// Read implements io.Reader
+func (r *decodingReader) Read(p []byte) (int, error) {
+	if r.decoder == nil {
+		// Peek to tell an empty body, such as from a HEAD request, from an
+		// invalid one.
+		br := bufio.NewReader(r.delegate)
+		if _, err := br.Peek(1); err != nil {
+			return 0, err
+		}
+		decoder, err := r.newReader(br)
+		if err != nil {
+			return 0, err
+		}
+		r.decoder = decoder
+	}
+	return r.decoder.Read(p)
+}
+
+// Close closes the decoder and the delegate.
+func (r *decodingReader) Close() (err error) {
+	if r.decoder != nil {
+		err = r.decoder.Close()
+	}
+	if delegateErr := r.delegate.Close(); err == nil {
+		err = delegateErr
+	}
+	return
+}
+
+// encodingWriter encodes writes to the delegate until flushed.
+type encodingWriter struct {
+	io.WriteCloser
+	delegate io.Writer
+}
+
+// Flush implements http.Flusher by closing the encoder, which writes any
+// trailing data, then flushing the delegate if it is a http.Flusher.
+func (w *encodingWriter) Flush() {
+	w.Close() // nolint
+	if f, ok := w.delegate.(http.Flusher); ok {
+		f.Flush()
+	}
+}
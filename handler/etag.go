@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ETagPolicy defines what happens to a strong "ETag" response header when the
+// guest rewrites the response body. See RewriteETag.
+type ETagPolicy uint8
+
+const (
+	// ETagDrop removes any strong "ETag", as it no longer matches the body.
+	ETagDrop ETagPolicy = iota + 1
+
+	// ETagRecompute replaces any strong "ETag" with one derived from the
+	// SHA-256 hash of the body written by the guest. If the response headers
+	// were already sent, the "ETag" is only dropped.
+	ETagRecompute
+)
+
+// etagBody returns a writer that handles any strong "ETag" of the response
+// according to the ETagPolicy. Weak ETags are left as-is, as the guest may
+// not change the body's meaning.
+func (m *middleware) etagBody(ctx context.Context, w io.Writer) io.Writer {
+	if m.etagPolicy == 0 {
+		return w
+	}
+	values := m.host.GetResponseHeaderValues(ctx, "ETag")
+	if len(values) == 0 || strings.HasPrefix(values[0], "W/") {
+		return w
+	}
+
+	m.host.RemoveResponseHeader(ctx, "ETag")
+	if m.etagPolicy == ETagDrop {
+		return w
+	}
+	return &etagWriter{ctx: ctx, setHeader: m.host.SetResponseHeaderValue, hash: sha256.New(), delegate: w}
+}
+
+// etagWriter hashes writes to the delegate until flushed.
+type etagWriter struct {
+	ctx       context.Context
+	setHeader func(ctx context.Context, name, value string)
+	hash      hash.Hash
+	delegate  io.Writer
+}
+
+// Write implements io.Writer
+func (w *etagWriter) Write(p []byte) (int, error) {
+	w.hash.Write(p) // never errs
+	return w.delegate.Write(p)
+}
+
+// Flush implements http.Flusher by setting the "ETag" header, then flushing
+// the delegate if it is a http.Flusher.
+func (w *etagWriter) Flush() {
+	sum := w.hash.Sum(nil)
+	w.setHeader(w.ctx, "ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	if f, ok := w.delegate.(http.Flusher); ok {
+		f.Flush()
+	}
+}
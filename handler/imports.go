@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	wazeroapi "github.com/tetratelabs/wazero/api"
+
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
+)
+
+// ImportPolicy restricts the handler.HostModule functions the guest may use.
+// See AllowImports.
+type ImportPolicy struct {
+	// Allowed are the names of functions the guest may use, such as
+	// handler.FuncGetURI.
+	Allowed []string
+
+	// Trap lets the guest import functions not Allowed, but traps when it
+	// calls them. By default, NewMiddleware fails instead. This supports
+	// guests that only call them conditionally, such as per configuration.
+	Trap bool
+}
+
+// ReadOnlyImports are functions that observe, but don't change requests or
+// responses. Use them in ImportPolicy.Allowed for third-party guests.
+var ReadOnlyImports = []string{
+	handler.FuncEnableFeatures,
+	handler.FuncGetConfig,
+	handler.FuncLogEnabled,
+	handler.FuncLog,
+	handler.FuncGetMethod,
+	handler.FuncGetURI,
+	handler.FuncGetAuthority,
+	handler.FuncGetScheme,
+	handler.FuncGetProtocolVersion,
+	handler.FuncGetHeaderNames,
+	handler.FuncGetHeaderValues,
+	handler.FuncGetHeaders,
+	handler.FuncGetQueryValues,
+	handler.FuncGetCookieValues,
+	handler.FuncPeekBody,
+	handler.FuncGetStatusCode,
+	handler.FuncGetSourceAddr,
+	handler.FuncGetHostError,
+	handler.FuncIsCanceled,
+}
+
+// allows returns true if the guest may call the host function, which is
+// always the case without a policy.
+func (p *ImportPolicy) allows(name string) bool {
+	if p == nil {
+		return true
+	}
+	for _, allowed := range p.Allowed {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// checkImports returns an error listing any host functions imported by the
+// guest that the policy doesn't allow, unless it traps them instead.
+func (p *ImportPolicy) checkImports(importedFns []wazeroapi.FunctionDefinition) error {
+	if p == nil || p.Trap {
+		return nil
+	}
+
+	var denied []string
+	for _, f := range importedFns {
+		if moduleName, name, _ := f.Import(); moduleName == handler.HostModule && !p.allows(name) {
+			denied = append(denied, name)
+		}
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+	sort.Strings(denied)
+	return fmt.Errorf("wasm: guest imports functions the import policy doesn't allow: %s", strings.Join(denied, ", "))
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/wazero"
+
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
+	"github.com/http-wasm/http-wasm-host-go/internal/test"
+)
+
+func TestAllowImports(t *testing.T) {
+	mw, err := NewMiddleware(testCtx, test.BinE2EMethod, handler.UnimplementedHost{},
+		AllowImports(ImportPolicy{Allowed: ReadOnlyImports}))
+	requireEqualError(t, err, "wasm: guest imports functions the import policy doesn't allow: set_method, write_body")
+	if mw != nil {
+		mw.Close(testCtx)
+	}
+}
+
+func TestAllowImports_Trap(t *testing.T) {
+	// Don't abort the guest on cancellation, so it reaches set_status_code.
+	newRuntime := func(ctx context.Context) (wazero.Runtime, error) {
+		return wazero.NewRuntime(ctx), nil
+	}
+	mw, err := NewMiddleware(testCtx, test.BinE2EIsCanceled, handler.UnimplementedHost{}, Runtime(newRuntime),
+		AllowImports(ImportPolicy{Allowed: []string{handler.FuncIsCanceled}, Trap: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	ctx, cancel := context.WithCancel(testCtx)
+	cancel()
+
+	expectedError := "can't call set_status_code as the import policy doesn't allow it"
+	if _, _, err = mw.HandleRequest(ctx); err == nil || !strings.Contains(err.Error(), expectedError) {
+		t.Errorf("expected error to contain %q, have: %v", expectedError, err)
+	}
+}
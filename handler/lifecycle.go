@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	wazeroapi "github.com/tetratelabs/wazero/api"
+
+	"github.com/http-wasm/http-wasm-host-go/api"
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
+)
+
+// InitError is returned when the guest fails handler.FuncInit, such as due to
+// invalid configuration. Use errors.As to read the guest's message.
+type InitError struct {
+	// Message is the error message written by the guest.
+	Message string
+}
+
+// Error implements error
+func (e *InitError) Error() string {
+	return fmt.Sprintf("wasm: guest failed to init: %s", e.Message)
+}
+
+// init calls the WebAssembly guest function handler.FuncInit, if exported.
+func (g *guest) init(ctx context.Context) error {
+	initFn := g.guest.ExportedFunction(handler.FuncInit)
+	if initFn == nil {
+		return nil
+	}
+
+	results, err := g.call(ctx, initFn)
+	if err != nil {
+		return fmt.Errorf("wasm: error calling guest init: %w", err)
+	}
+
+	offsetLen := results[0]
+	offset, length := uint32(offsetLen>>32), uint32(offsetLen)
+	if length == 0 {
+		return nil
+	}
+	message, ok := g.guest.Memory().Read(offset, length)
+	if !ok {
+		return &InitError{Message: fmt.Sprintf("out of memory reading message (%d, %d)", offset, length)}
+	}
+	return &InitError{Message: string(message)}
+}
+
+// shutdownGuests calls the WebAssembly guest function handler.FuncShutdown on
+// each guest in the pool and any dedicated to handler.FuncTick, within the
+// shutdown timeout. Guests in use aren't shut down. Guests the pool evicted
+// were shut down by evictGuest, except any not yet garbage collected, which
+// can't be reached.
+func (m *middleware) shutdownGuests(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, m.shutdownTimeout)
+	defer cancel()
+
+	if m.ticker != nil {
+		m.shutdownGuest(ctx, m.ticker.g)
+	}
+	for {
+		g, ok := m.pool.Get().(*guest)
+		if !ok {
+			return
+		}
+		m.shutdownGuest(ctx, g)
+	}
+}
+
+// evictGuest is the finalizer of pooled guests, which the pool evicts when
+// idle. It shuts down the guest, unless the middleware is closed, then
+// closes it. This runs in a new goroutine, to not block other finalizers.
+func (m *middleware) evictGuest(g *guest) {
+	go func() {
+		m.evictMu.RLock()
+		defer m.evictMu.RUnlock()
+
+		ctx := context.Background()
+		if !m.closed {
+			shutdownCtx, cancel := context.WithTimeout(ctx, m.shutdownTimeout)
+			m.shutdownGuest(shutdownCtx, g)
+			cancel()
+		}
+		if err := g.guest.Close(ctx); err != nil {
+			m.logger.Log(ctx, api.LogLevelError, fmt.Sprintf("closing guest module: %v", err))
+		}
+	}()
+}
+
+func (m *middleware) shutdownGuest(ctx context.Context, g *guest) {
+	if g.shutdownFn == nil || g.guest.IsClosed() {
+		return
+	}
+	if _, err := g.call(ctx, g.shutdownFn); err != nil {
+		m.logger.Log(ctx, api.LogLevelError, fmt.Sprintf("shutting down guest module: %v", err))
+	}
+}
+
+// tickKey is a context.Context value present while calling
+// handler.FuncTick.
+type tickKey struct{}
+
+// ticker calls the WebAssembly guest function handler.FuncTick on a dedicated
+// guest, until stopped.
+type ticker struct {
+	g      *guest
+	tickFn wazeroapi.Function
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// startTicker instantiates the guest dedicated to handler.FuncTick and starts
+// calling it every tick interval.
+func (m *middleware) startTicker(ctx context.Context) error {
+	if m.tickInterval <= 0 {
+		return fmt.Errorf("wasm: invalid tick interval: %v", m.tickInterval)
+	}
+	g, err := m.newGuest(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Don't inherit the cancellation of ctx, as ticks continue until Close.
+	tickCtx, cancel := context.WithCancel(context.WithValue(context.Background(), tickKey{}, struct{}{}))
+	m.ticker = &ticker{
+		g:      g,
+		tickFn: g.guest.ExportedFunction(handler.FuncTick),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go m.ticker.run(tickCtx, m.tickInterval, m.logger)
+	return nil
+}
+
+func (t *ticker) run(ctx context.Context, interval time.Duration, logger api.Logger) {
+	defer close(t.done)
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		if _, err := t.g.call(ctx, t.tickFn); err != nil {
+			if t.g.guest.IsClosed() {
+				return // aborted, so the guest is no longer usable.
+			}
+			logger.Log(ctx, api.LogLevelError, fmt.Sprintf("calling guest tick: %v", err))
+		}
+	}
+}
+
+// stop cancels any tick in progress and waits for the ticker to return.
+func (t *ticker) stop() {
+	t.cancel()
+	<-t.done
+}
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"path"
+	"strings"
+
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
+)
+
+// Matcher decides if the guest should handle the current request. Matchers
+// are evaluated on the host before a guest is taken from the pool, so a
+// mismatch skips the guest entirely and the request proceeds to the next
+// handler.
+//
+// Matchers only have access to the request via handler.Host, so they work
+// with any host. They must be safe for concurrent use.
+type Matcher func(ctx context.Context, host handler.Host) bool
+
+// PathPrefix matches requests whose escaped path begins with the prefix.
+// Ex. PathPrefix("/api/") matches "/api/v1" but not "/apis".
+func PathPrefix(prefix string) Matcher {
+	return func(ctx context.Context, host handler.Host) bool {
+		return strings.HasPrefix(requestPath(ctx, host), prefix)
+	}
+}
+
+// PathGlob matches requests whose escaped path matches the pattern, using
+// the syntax of path.Match. Ex. PathGlob("/v1/*/users") matches
+// "/v1/tenant/users".
+//
+// Note: This panics if the pattern is malformed.
+func PathGlob(pattern string) Matcher {
+	if _, err := path.Match(pattern, ""); err != nil {
+		panic(fmt.Errorf("invalid path glob %q: %w", pattern, err))
+	}
+	return func(ctx context.Context, host handler.Host) bool {
+		matched, _ := path.Match(pattern, requestPath(ctx, host))
+		return matched
+	}
+}
+
+// Methods matches requests whose method is one of the given values. The
+// comparison is case-sensitive. Ex. Methods("POST", "PUT")
+func Methods(methods ...string) Matcher {
+	set := make(map[string]struct{}, len(methods))
+	for _, m := range methods {
+		set[m] = struct{}{}
+	}
+	return func(ctx context.Context, host handler.Host) bool {
+		_, ok := set[host.GetMethod(ctx)]
+		return ok
+	}
+}
+
+// HeaderPresent matches requests that include at least one value for the
+// request header with the given name, even if empty.
+func HeaderPresent(name string) Matcher {
+	return func(ctx context.Context, host handler.Host) bool {
+		return len(host.GetRequestHeaderValues(ctx, name)) > 0
+	}
+}
+
+// Sample matches a random percentage of requests, where percent is between
+// 0 and 100. Ex. Sample(10) matches roughly one in ten requests.
+func Sample(percent float64) Matcher {
+	return func(context.Context, handler.Host) bool {
+		switch {
+		case percent <= 0:
+			return false
+		case percent >= 100:
+			return true
+		default:
+			return rand.Float64()*100 < percent
+		}
+	}
+}
+
+// Not matches requests the given matcher doesn't. Ex. Not(PathPrefix("/healthz"))
+func Not(matcher Matcher) Matcher {
+	return func(ctx context.Context, host handler.Host) bool {
+		return !matcher(ctx, host)
+	}
+}
+
+// Any matches requests that match at least one of the given matchers.
+func Any(matchers ...Matcher) Matcher {
+	return func(ctx context.Context, host handler.Host) bool {
+		for _, m := range matchers {
+			if m(ctx, host) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// requestPath returns the escaped path of handler.Host GetURI, without any
+// query.
+func requestPath(ctx context.Context, host handler.Host) string {
+	uri := host.GetURI(ctx)
+	if i := strings.IndexByte(uri, '?'); i != -1 {
+		uri = uri[:i]
+	}
+	return uri
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
+	"github.com/http-wasm/http-wasm-host-go/internal/test"
+)
+
+type matcherHost struct {
+	handler.UnimplementedHost
+	method, uri string
+	headers     map[string][]string
+}
+
+func (h matcherHost) GetMethod(context.Context) string { return h.method }
+
+func (h matcherHost) GetURI(context.Context) string { return h.uri }
+
+func (h matcherHost) GetRequestHeaderValues(_ context.Context, name string) []string {
+	return h.headers[name]
+}
+
+func TestMatcher(t *testing.T) {
+	host := matcherHost{
+		method:  "POST",
+		uri:     "/v1/tenant/users?name=panda",
+		headers: map[string][]string{"Authorization": {""}},
+	}
+
+	tests := []struct {
+		name     string
+		matcher  Matcher
+		expected bool
+	}{
+		{name: "PathPrefix match", matcher: PathPrefix("/v1/"), expected: true},
+		{name: "PathPrefix ignores query", matcher: PathPrefix("/v1/tenant/users?"), expected: false},
+		{name: "PathPrefix mismatch", matcher: PathPrefix("/healthz"), expected: false},
+		{name: "PathGlob match", matcher: PathGlob("/v1/*/users"), expected: true},
+		{name: "PathGlob mismatch", matcher: PathGlob("/v1/*"), expected: false},
+		{name: "Methods match", matcher: Methods("PUT", "POST"), expected: true},
+		{name: "Methods mismatch", matcher: Methods("GET"), expected: false},
+		{name: "Methods case-sensitive", matcher: Methods("post"), expected: false},
+		{name: "HeaderPresent empty value", matcher: HeaderPresent("Authorization"), expected: true},
+		{name: "HeaderPresent missing", matcher: HeaderPresent("Cookie"), expected: false},
+		{name: "Sample 0", matcher: Sample(0), expected: false},
+		{name: "Sample 100", matcher: Sample(100), expected: true},
+		{name: "Not", matcher: Not(PathPrefix("/healthz")), expected: true},
+		{name: "Any match", matcher: Any(Methods("GET"), PathPrefix("/v1")), expected: true},
+		{name: "Any mismatch", matcher: Any(Methods("GET"), PathPrefix("/v2")), expected: false},
+		{name: "Any empty", matcher: Any(), expected: false},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			if want, have := tc.expected, tc.matcher(testCtx, host); want != have {
+				t.Errorf("unexpected match, want: %v, have: %v", want, have)
+			}
+		})
+	}
+}
+
+func TestPathGlob_Invalid(t *testing.T) {
+	defer func() {
+		if recovered := recover(); recovered == nil {
+			t.Error("expected a panic")
+		}
+	}()
+	PathGlob("/[")
+}
+
+type countingMetrics struct {
+	handled, skipped atomic.Uint64
+}
+
+func (m *countingMetrics) RequestHandled(context.Context) { m.handled.Add(1) }
+
+func (m *countingMetrics) RequestSkipped(context.Context) { m.skipped.Add(1) }
+
+func TestMiddlewareHandleRequest_Skipped(t *testing.T) {
+	metrics := &countingMetrics{}
+	host := matcherHost{method: "GET", uri: "/healthz"}
+
+	// BinErrorPanicOnHandleRequest fails the test if the guest is called.
+	mw, err := NewMiddleware(testCtx, test.BinErrorPanicOnHandleRequest, host,
+		Match(Not(PathPrefix("/healthz"))), Metrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	ctx, ctxNext, err := mw.HandleRequest(testCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := handler.CtxNext(1), ctxNext; want != have {
+		t.Errorf("unexpected ctxNext, want: %d, have: %d", want, have)
+	}
+	if err = mw.HandleResponse(ctx, uint32(ctxNext>>32), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := uint64(1), metrics.skipped.Load(); want != have {
+		t.Errorf("unexpected skipped count, want: %d, have: %d", want, have)
+	}
+	if want, have := uint64(0), metrics.handled.Load(); want != have {
+		t.Errorf("unexpected handled count, want: %d, have: %d", want, have)
+	}
+}
+
+func TestMiddlewareHandleRequest_InstantiateError(t *testing.T) {
+	metrics := &countingMetrics{}
+	mw, err := NewMiddleware(testCtx, test.BinE2EProtocolVersion, handler.UnimplementedHost{}, Metrics(metrics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	// Replace the pool, which has the guest NewMiddleware instantiated, and
+	// close the runtime, so that the request needs a guest that can't be
+	// instantiated. Emptying the pool with Get isn't reliable, as sync.Pool
+	// can return a guest put on another P.
+	m := mw.(*middleware)
+	m.pool = sync.Pool{}
+	_ = m.runtime.Close(testCtx)
+
+	if _, _, err = mw.HandleRequest(testCtx); err == nil {
+		t.Fatal("expected an error instantiating the guest")
+	}
+	if want, have := uint64(0), metrics.handled.Load(); want != have {
+		t.Errorf("unexpected handled count, want: %d, have: %d", want, have)
+	}
+}
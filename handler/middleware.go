@@ -3,13 +3,15 @@ package handler
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"runtime"
 	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/tetratelabs/wazero"
 	wazeroapi "github.com/tetratelabs/wazero/api"
@@ -25,6 +27,9 @@ type Middleware interface {
 	// HandleRequest handles a request by calling handler.FuncHandleRequest on
 	// the guest.
 	//
+	// If the request doesn't match the Matcher options, the guest isn't
+	// called and handler.CtxNext is returned with `next=1`.
+	//
 	// Note: If the handler.CtxNext is returned with `next=1`, you must call
 	// HandleResponse.
 	HandleRequest(ctx context.Context) (outCtx context.Context, ctxNext handler.CtxNext, err error)
@@ -36,9 +41,20 @@ type Middleware interface {
 	// The ctx and ctxNext parameters are those returned from HandleRequest.
 	// Specifically, the handler.CtxNext "ctx" field is passed as `reqCtx`.
 	// The err parameter is nil unless the host erred processing the next
-	// handler.
+	// handler. The guest can read it via handler.FuncGetHostError, which
+	// categorizes it as a handler.ErrorKind. Use handler.PanicError for
+	// panics, or implement `ErrorKind() handler.ErrorKind` on the error.
 	HandleResponse(ctx context.Context, reqCtx uint32, err error) error
 
+	// HandleResponseHeaders handles response headers by calling
+	// handler.FuncHandleResponseHeaders on the guest. Hosts call this when
+	// handler.FeatureResponseHeaders is enabled, before the response status
+	// and headers produced by the next handler are sent.
+	//
+	// The ctx and reqCtx parameters are the same as HandleResponse. This is
+	// a no-op if the feature isn't enabled for the current request.
+	HandleResponseHeaders(ctx context.Context, reqCtx uint32) error
+
 	// Features are the features enabled while initializing the guest. This
 	// value won't change per-request.
 	Features() handler.Features
@@ -55,9 +71,40 @@ type middleware struct {
 	moduleConfig    wazero.ModuleConfig
 	guestConfig     []byte
 	logger          api.Logger
+	matchers        []Matcher
+	metrics         api.Metrics
+	contentDecoding ContentEncodingPolicy
+	etagPolicy      ETagPolicy
+	shutdownTimeout time.Duration
+	tickInterval    time.Duration
+	logGuestOutput  bool
+	stdoutLevel     api.LogLevel
+	stderrLevel     api.LogLevel
+	guestName       string
+	importPolicy    *ImportPolicy
 	pool            sync.Pool
 	features        handler.Features
 	instanceCounter uint64
+
+	// recorder is nil unless Record.
+	recorder Recorder
+
+	// hostFuncs are the definitions of host functions by name, to record
+	// their calls.
+	hostFuncs map[string]wazeroapi.FunctionDefinition
+
+	// ticker is nil unless the guest exports handler.FuncTick.
+	ticker *ticker
+
+	// evictMu is read-locked while shutting down a guest evicted from the
+	// pool, so that Close waits for it. closed is true once Close was called.
+	evictMu sync.RWMutex
+	closed  bool
+
+	// unsupportedFeatures are features that can't be enabled as the host
+	// doesn't implement the corresponding optional interface, or the guest
+	// doesn't export the corresponding function.
+	unsupportedFeatures handler.Features
 }
 
 func (m *middleware) Features() handler.Features {
@@ -66,13 +113,34 @@ func (m *middleware) Features() handler.Features {
 
 func NewMiddleware(ctx context.Context, guest []byte, host handler.Host, opts ...Option) (Middleware, error) {
 	o := &options{
-		newRuntime:   DefaultRuntime,
-		moduleConfig: wazero.NewModuleConfig(),
-		logger:       api.NoopLogger{},
+		newRuntime: DefaultRuntime,
+		logger:     api.NoopLogger{},
+		metrics:    api.NoopMetrics{},
+
+		shutdownTimeout: 5 * time.Second,
+		tickInterval:    time.Second,
 	}
 	for _, opt := range opts {
 		opt(o)
 	}
+	if o.decodeContent && o.contentDecoding != ContentEncodingReencode && o.contentDecoding != ContentEncodingDrop {
+		return nil, fmt.Errorf("wasm: unknown ContentEncodingPolicy %d", o.contentDecoding)
+	}
+
+	if o.verifier != nil {
+		if err := o.verifier.Verify(guest); err != nil {
+			return nil, fmt.Errorf("wasm: error verifying guest: %w", err)
+		}
+	}
+	if o.sandbox != nil {
+		// A ModuleConfig could grant capabilities outside the policy.
+		if o.moduleConfig != nil {
+			return nil, errors.New("wasm: Sandbox can't be combined with ModuleConfig")
+		}
+		o.moduleConfig = o.sandbox.moduleConfig()
+	} else if o.moduleConfig == nil {
+		o.moduleConfig = wazero.NewModuleConfig()
+	}
 
 	wr, err := o.newRuntime(ctx)
 	if err != nil {
@@ -85,12 +153,57 @@ func NewMiddleware(ctx context.Context, guest []byte, host handler.Host, opts ..
 		moduleConfig: o.moduleConfig,
 		guestConfig:  o.guestConfig,
 		logger:       o.logger,
+		matchers:     o.matchers,
+		metrics:      o.metrics,
+
+		contentDecoding: o.contentDecoding,
+		etagPolicy:      o.etagPolicy,
+		shutdownTimeout: o.shutdownTimeout,
+		tickInterval:    o.tickInterval,
+		logGuestOutput:  o.logGuestOutput,
+		stdoutLevel:     o.stdoutLevel,
+		stderrLevel:     o.stderrLevel,
+		importPolicy:    o.importPolicy,
+		recorder:        o.recorder,
+	}
+
+	if o.allowedFeatures != nil {
+		m.unsupportedFeatures = ^*o.allowedFeatures
+	}
+	if _, ok := host.(handler.QueryCookiesHost); !ok {
+		m.unsupportedFeatures |= handler.FeatureQueryCookies
+	}
+	if _, ok := host.(handler.InformationalHost); !ok {
+		m.unsupportedFeatures |= handler.FeatureInformational
 	}
 
 	if m.guestModule, err = m.compileGuest(ctx, guest); err != nil {
 		_ = wr.Close(ctx)
 		return nil, err
 	}
+	if m.guestName = m.guestModule.Name(); m.guestName == "" {
+		m.guestName = "guest"
+	}
+	if _, ok := m.guestModule.ExportedFunctions()[handler.FuncHandleResponseHeaders]; !ok {
+		m.unsupportedFeatures |= handler.FeatureResponseHeaders
+	}
+
+	// A WASI reactor, such as a guest built by Go with -buildmode=c-shared,
+	// must be initialized with "_initialize" instead of "_start".
+	if _, ok := m.guestModule.ExportedFunctions()["_initialize"]; ok {
+		m.moduleConfig = m.moduleConfig.WithStartFunctions("_initialize")
+	}
+
+	if o.sandbox != nil {
+		if err = o.sandbox.checkImports(m.guestModule.ImportedFunctions()); err != nil {
+			_ = wr.Close(ctx)
+			return nil, err
+		}
+	}
+	if err = m.importPolicy.checkImports(m.guestModule.ImportedFunctions()); err != nil {
+		_ = wr.Close(ctx)
+		return nil, err
+	}
 
 	// Detect and handle any host imports or lack thereof.
 	imports := detectImports(m.guestModule.ImportedFunctions())
@@ -105,10 +218,12 @@ func NewMiddleware(ctx context.Context, guest []byte, host handler.Host, opts ..
 
 		fallthrough // proceed to configure any http_handler imports
 	case imports&importHttpHandler != 0:
-		if _, err = m.instantiateHost(ctx); err != nil {
+		hostModule, err := m.instantiateHost(ctx)
+		if err != nil {
 			_ = wr.Close(ctx)
 			return nil, fmt.Errorf("wasm: error instantiating host: %w", err)
 		}
+		m.hostFuncs = hostModule.ExportedFunctionDefinitions()
 	}
 
 	// Eagerly add one instance to the pool. Doing so helps to fail fast.
@@ -119,6 +234,13 @@ func NewMiddleware(ctx context.Context, guest []byte, host handler.Host, opts ..
 		m.pool.Put(g)
 	}
 
+	if _, ok := m.guestModule.ExportedFunctions()[handler.FuncTick]; ok {
+		if err = m.startTicker(ctx); err != nil {
+			_ = wr.Close(ctx)
+			return nil, err
+		}
+	}
+
 	return m, nil
 }
 
@@ -133,6 +255,18 @@ func (m *middleware) compileGuest(ctx context.Context, wasm []byte) (wazero.Comp
 		return nil, fmt.Errorf("wasm: guest doesn't export func[%s]", handler.FuncHandleResponse)
 	} else if !bytes.Equal(handleResponse.ParamTypes(), []wazeroapi.ValueType{wazeroapi.ValueTypeI32, wazeroapi.ValueTypeI32}) || len(handleResponse.ResultTypes()) != 0 {
 		return nil, fmt.Errorf("wasm: guest exports the wrong signature for func[%s]. should be (i32, 32) -> ()", handler.FuncHandleResponse)
+	} else if handleResponseHeaders, ok := guest.ExportedFunctions()[handler.FuncHandleResponseHeaders]; ok &&
+		(!bytes.Equal(handleResponseHeaders.ParamTypes(), []wazeroapi.ValueType{wazeroapi.ValueTypeI32}) || len(handleResponseHeaders.ResultTypes()) != 0) {
+		return nil, fmt.Errorf("wasm: guest exports the wrong signature for func[%s]. should be (i32) -> ()", handler.FuncHandleResponseHeaders)
+	} else if initFn, ok := guest.ExportedFunctions()[handler.FuncInit]; ok &&
+		(len(initFn.ParamTypes()) != 0 || !bytes.Equal(initFn.ResultTypes(), []wazeroapi.ValueType{wazeroapi.ValueTypeI64})) {
+		return nil, fmt.Errorf("wasm: guest exports the wrong signature for func[%s]. should be () -> (i64)", handler.FuncInit)
+	} else if shutdownFn, ok := guest.ExportedFunctions()[handler.FuncShutdown]; ok &&
+		(len(shutdownFn.ParamTypes()) != 0 || len(shutdownFn.ResultTypes()) != 0) {
+		return nil, fmt.Errorf("wasm: guest exports the wrong signature for func[%s]. should be () -> ()", handler.FuncShutdown)
+	} else if tickFn, ok := guest.ExportedFunctions()[handler.FuncTick]; ok &&
+		(len(tickFn.ParamTypes()) != 0 || len(tickFn.ResultTypes()) != 0) {
+		return nil, fmt.Errorf("wasm: guest exports the wrong signature for func[%s]. should be () -> ()", handler.FuncTick)
 	} else if _, ok = guest.ExportedMemories()[api.Memory]; !ok {
 		return nil, fmt.Errorf("wasm: guest doesn't export memory[%s]", api.Memory)
 	} else {
@@ -142,33 +276,77 @@ func (m *middleware) compileGuest(ctx context.Context, wasm []byte) (wazero.Comp
 
 // HandleRequest implements Middleware.HandleRequest
 func (m *middleware) HandleRequest(ctx context.Context) (outCtx context.Context, ctxNext handler.CtxNext, err error) {
-	g, guestErr := m.getOrCreateGuest(ctx)
+	// Skip the guest, proceeding to the next handler, if the request doesn't
+	// match. HandleResponse recognizes this by the lack of request state.
+	if !m.matches(ctx) {
+		m.metrics.RequestSkipped(ctx)
+		return ctx, 1, nil
+	}
+
+	// A pooled guest has state from the requests it handled before, which
+	// can't be replayed. So, sampled requests are handled by a new guest,
+	// which is discarded after the request.
+	var recording *Recording
+	if m.recorder != nil && m.recorder.Sample(ctx) {
+		recording = &Recording{}
+	}
+	var g *guest
+	var guestErr error
+	if recording != nil {
+		g, guestErr = m.newGuest(context.WithValue(ctx, recordingKey{}, recording))
+	} else {
+		g, guestErr = m.getOrCreateGuest(ctx)
+	}
 	if guestErr != nil {
 		err = guestErr
 		return
 	}
+	m.metrics.RequestHandled(ctx)
 
-	s := &requestState{features: m.features, putPool: m.pool.Put, g: g}
+	s := &requestState{features: m.features, putPool: m.pool.Put, g: g, recording: recording}
+	if recording != nil {
+		s.putPool = func(any) { m.evictGuest(g) }
+	}
 	defer func() {
 		if ctxNext != 0 { // will call the next handler
 			if closeErr := s.closeRequest(); err == nil {
 				err = closeErr
 			}
 		} else { // guest errored or returned the response
+			m.record(ctx, s)
 			if closeErr := s.Close(); err == nil {
 				err = closeErr
 			}
 		}
 	}()
 
-	outCtx = context.WithValue(ctx, requestStateKey{}, s)
+	outCtx = ctx
+	if m.recorder != nil {
+		// Always set the recording, so that it isn't one of another
+		// middleware handling the same request.
+		outCtx = context.WithValue(outCtx, recordingKey{}, s.recording)
+	}
+	outCtx = context.WithValue(outCtx, requestStateKey{}, s)
 	ctxNext, err = g.handleRequest(outCtx)
 	return
 }
 
+// matches returns true if all matchers match the current request.
+func (m *middleware) matches(ctx context.Context) bool {
+	for _, matcher := range m.matchers {
+		if !matcher(ctx, m.host) {
+			return false
+		}
+	}
+	return true
+}
+
 func (m *middleware) getOrCreateGuest(ctx context.Context) (*guest, error) {
 	poolG := m.pool.Get()
 	if poolG == nil {
+		// Don't record instantiating the guest into the recording of another
+		// middleware handling the same request.
+		ctx = context.WithValue(ctx, recordingKey{}, (*Recording)(nil))
 		if g, createErr := m.newGuest(ctx); createErr != nil {
 			return nil, createErr
 		} else {
@@ -176,15 +354,7 @@ func (m *middleware) getOrCreateGuest(ctx context.Context) (*guest, error) {
 			// runs its own GC there are no guarantees that the guest module will be
 			// closed and hence we need to ensure that the guest module is closed with
 			// a finalizer.
-			runtime.SetFinalizer(g, func(g *guest) {
-				if err := g.guest.Close(context.Background()); err != nil {
-					m.logger.Log(ctx, api.LogLevelError, fmt.Sprintf("closing guest module: %v", err))
-				} else {
-					g.guest = nil
-					g.handleRequestFn = nil
-					g.handleResponseFn = nil
-				}
-			})
+			runtime.SetFinalizer(g, m.evictGuest)
 
 			poolG = g
 		}
@@ -194,44 +364,122 @@ func (m *middleware) getOrCreateGuest(ctx context.Context) (*guest, error) {
 
 // HandleResponse implements Middleware.HandleResponse
 func (m *middleware) HandleResponse(ctx context.Context, reqCtx uint32, hostErr error) error {
-	s := requestStateFromContext(ctx)
+	s, ok := ctx.Value(requestStateKey{}).(*requestState)
+	if !ok { // HandleRequest skipped the guest.
+		return nil
+	}
 	defer s.Close()
 	s.afterNext = true
+	s.hostErr = hostErr
 
-	return s.g.handleResponse(ctx, reqCtx, hostErr)
+	err := s.g.handleResponse(ctx, reqCtx, hostErr)
+	m.record(ctx, s)
+	return err
+}
+
+// HandleResponseHeaders implements Middleware.HandleResponseHeaders
+func (m *middleware) HandleResponseHeaders(ctx context.Context, reqCtx uint32) error {
+	s, ok := ctx.Value(requestStateKey{}).(*requestState)
+	if !ok || !s.features.IsEnabled(handler.FeatureResponseHeaders) {
+		return nil
+	}
+	s.afterNext = true
+	s.inResponseHeaders = true
+	defer func() { s.inResponseHeaders = false }()
+
+	return s.g.handleResponseHeaders(ctx, reqCtx)
 }
 
 // Close implements api.Closer
 func (m *middleware) Close(ctx context.Context) error {
+	if m.ticker != nil {
+		m.ticker.stop()
+	}
+	// Wait for guests evicted from the pool to shut down.
+	m.evictMu.Lock()
+	m.closed = true
+	m.evictMu.Unlock()
+	m.shutdownGuests(ctx)
 	// We don't have to close any guests as the middleware will close it.
 	return m.runtime.Close(ctx)
 }
 
 type guest struct {
 	guest            wazeroapi.Module
+	output           *guestOutput // nil unless GuestOutput
 	handleRequestFn  wazeroapi.Function
 	handleResponseFn wazeroapi.Function
+
+	// handleResponseHeadersFn is nil unless the guest exports
+	// handler.FuncHandleResponseHeaders.
+	handleResponseHeadersFn wazeroapi.Function
+
+	// shutdownFn is nil unless the guest exports handler.FuncShutdown.
+	shutdownFn wazeroapi.Function
+
+	// recorded is true if calls to the guest are recorded, when the
+	// context.Context has a Recording. Only guests of sampled requests are.
+	recorded bool
 }
 
+// newGuest instantiates and initializes a guest for the pool. This ignores
+// cancellation of ctx, such as when the client of the request that needed
+// the guest disconnected, as the guest outlives that request.
+//
+// If ctx has a Recording, the calls made instantiating the guest are
+// recorded, and so are its later calls with that Recording.
 func (m *middleware) newGuest(ctx context.Context) (*guest, error) {
+	ctx = context.WithoutCancel(ctx)
 	moduleName := fmt.Sprintf("%d", atomic.AddUint64(&m.instanceCounter, 1))
 
-	g, err := m.runtime.InstantiateModule(ctx, m.guestModule, m.moduleConfig.WithName(moduleName))
+	moduleConfig := m.moduleConfig.WithName(moduleName)
+	rec := recordingFromContext(ctx)
+	var output *guestOutput
+	if m.logGuestOutput {
+		output = newGuestOutput(m.logger, m.guestName, m.stdoutLevel, m.stderrLevel)
+		moduleConfig = moduleConfig.WithStdout(&output.stdout).WithStderr(&output.stderr)
+		output.bind(ctx) // for any output of "_start"
+	}
+
+	mod, err := m.runtime.InstantiateModule(ctx, m.guestModule, moduleConfig)
+	if output != nil {
+		output.flush()
+	}
 	if err != nil {
-		_ = m.runtime.Close(ctx)
 		return nil, fmt.Errorf("wasm: error instantiating guest: %w", err)
 	}
 
-	return &guest{
-		guest:            g,
-		handleRequestFn:  g.ExportedFunction(handler.FuncHandleRequest),
-		handleResponseFn: g.ExportedFunction(handler.FuncHandleResponse),
-	}, nil
+	g := &guest{
+		guest:                   mod,
+		output:                  output,
+		handleRequestFn:         mod.ExportedFunction(handler.FuncHandleRequest),
+		handleResponseFn:        mod.ExportedFunction(handler.FuncHandleResponse),
+		handleResponseHeadersFn: mod.ExportedFunction(handler.FuncHandleResponseHeaders),
+		shutdownFn:              mod.ExportedFunction(handler.FuncShutdown),
+		recorded:                rec != nil,
+	}
+	if err = g.init(ctx); err != nil {
+		_ = mod.Close(ctx)
+		return nil, err
+	}
+	return g, nil
+}
+
+// call calls the WebAssembly guest function, correlating any output with ctx.
+func (g *guest) call(ctx context.Context, fn wazeroapi.Function, params ...uint64) ([]uint64, error) {
+	if o := g.output; o != nil {
+		o.bind(ctx)
+		defer o.flush()
+	}
+	if rec := recordingFromContext(ctx); rec != nil && g.recorded {
+		return rec.recordGuest(ctx, fn, params)
+	}
+	return fn.Call(ctx, params...)
 }
 
 // handleRequest calls the WebAssembly guest function handler.FuncHandleRequest.
 func (g *guest) handleRequest(ctx context.Context) (ctxNext handler.CtxNext, err error) {
-	if results, guestErr := g.handleRequestFn.Call(ctx); guestErr != nil {
+	if results, guestErr := g.call(ctx, g.handleRequestFn); guestErr != nil {
 		err = guestErr
 	} else {
 		ctxNext = handler.CtxNext(results[0])
@@ -245,18 +493,30 @@ func (g *guest) handleResponse(ctx context.Context, reqCtx uint32, err error) er
 	if err != nil {
 		wasError = 1
 	}
-	_, err = g.handleResponseFn.Call(ctx, uint64(reqCtx), wasError)
+	_, err = g.call(ctx, g.handleResponseFn, uint64(reqCtx), wasError)
+	return err
+}
+
+// handleResponseHeaders calls the WebAssembly guest function
+// handler.FuncHandleResponseHeaders.
+func (g *guest) handleResponseHeaders(ctx context.Context, reqCtx uint32) error {
+	_, err := g.call(ctx, g.handleResponseHeadersFn, uint64(reqCtx))
 	return err
 }
 
 // enableFeatures implements the WebAssembly host function handler.FuncEnableFeatures.
 func (m *middleware) enableFeatures(ctx context.Context, stack []uint64) {
-	features := handler.Features(stack[0])
+	// Don't ask the host for features it can't support, due to missing
+	// optional interfaces.
+	features := handler.Features(stack[0]) &^ m.unsupportedFeatures
 
 	var enabled handler.Features
 	if s, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
 		s.features = m.host.EnableFeatures(ctx, s.features.WithEnabled(features))
 		enabled = s.features
+	} else if ctx.Value(tickKey{}) != nil {
+		// Features are per-request or set on init, so can't change on tick.
+		panic(fmt.Errorf("can't call %s during %s", handler.FuncEnableFeatures, handler.FuncTick))
 	} else {
 		m.features = m.host.EnableFeatures(ctx, m.features.WithEnabled(features))
 		enabled = m.features
@@ -352,6 +612,70 @@ func (m *middleware) setURI(ctx context.Context, mod wazeroapi.Module, params []
 	m.host.SetURI(ctx, p)
 }
 
+// getAuthority implements the WebAssembly host function
+// handler.FuncGetAuthority.
+func (m *middleware) getAuthority(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	var authority string
+	if h, ok := m.host.(handler.AuthorityHost); ok {
+		authority = h.GetAuthority(ctx)
+	} else if values := m.host.GetRequestHeaderValues(ctx, "Host"); len(values) > 0 {
+		authority = values[0]
+	}
+	authorityLen := writeStringIfUnderLimit(mod.Memory(), buf, bufLimit, authority)
+
+	stack[0] = uint64(authorityLen)
+}
+
+// setAuthority implements the WebAssembly host function
+// handler.FuncSetAuthority.
+func (m *middleware) setAuthority(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	authority := uint32(params[0])
+	authorityLen := uint32(params[1])
+
+	_ = mustBeforeNext(ctx, "set", "authority")
+
+	var a string
+	if authorityLen > 0 { // overwrite with empty is supported
+		a = mustReadString(mod.Memory(), "authority", authority, authorityLen)
+	}
+	if h, ok := m.host.(handler.AuthorityHost); ok {
+		h.SetAuthority(ctx, a)
+	} else {
+		m.host.SetRequestHeaderValue(ctx, "Host", a)
+	}
+}
+
+// getScheme implements the WebAssembly host function handler.FuncGetScheme.
+func (m *middleware) getScheme(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	var scheme string
+	if h, ok := m.host.(handler.AuthorityHost); ok {
+		scheme = h.GetScheme(ctx)
+	}
+	schemeLen := writeStringIfUnderLimit(mod.Memory(), buf, bufLimit, scheme)
+
+	stack[0] = uint64(schemeLen)
+}
+
+// setScheme implements the WebAssembly host function handler.FuncSetScheme.
+func (m *middleware) setScheme(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	scheme := uint32(params[0])
+	schemeLen := uint32(params[1])
+
+	_ = mustBeforeNext(ctx, "set", "scheme")
+
+	h, ok := m.host.(handler.AuthorityHost)
+	if !ok {
+		panic("unsupported: set scheme")
+	}
+	h.SetScheme(ctx, mustReadString(mod.Memory(), "scheme", scheme, schemeLen))
+}
+
 // getProtocolVersion implements the WebAssembly host function
 // handler.FuncGetProtocolVersion.
 func (m *middleware) getProtocolVersion(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
@@ -388,18 +712,80 @@ func (m *middleware) getHeaderNames(ctx context.Context, mod wazeroapi.Module, s
 		panic("unsupported header kind: " + strconv.Itoa(int(kind)))
 	}
 
-	// TODO: This will allocate new strings all the time. It could be optimized
-	// by having writeNULTerminated directly lowercase while writing instead for
-	// this code path.
-	for i := range names {
-		names[i] = strings.ToLower(names[i])
+	var countLen handler.CountLen
+	if m.rawHeaders(ctx) {
+		countLen = writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, names)
+	} else {
+		countLen = writeNULTerminatedLower(ctx, mod.Memory(), buf, bufLimit, names, 1)
 	}
 
-	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, names)
+	stack[0] = countLen
+}
+
+// getHeaders implements the WebAssembly host function handler.FuncGetHeaders.
+func (m *middleware) getHeaders(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	kind := handler.HeaderKind(stack[0])
+	buf := uint32(stack[1])
+	bufLimit := handler.BufLimit(stack[2])
+
+	var fields []string
+	if h, ok := m.host.(handler.HeadersHost); ok {
+		switch kind {
+		case handler.HeaderKindRequest, handler.HeaderKindRequestTrailers,
+			handler.HeaderKindResponse, handler.HeaderKindResponseTrailers:
+			fields = h.GetHeaders(ctx, kind)
+		default:
+			panic("unsupported header kind: " + strconv.Itoa(int(kind)))
+		}
+	} else {
+		fields = m.deriveHeaders(ctx, kind)
+	}
+
+	var countLen handler.CountLen
+	if m.rawHeaders(ctx) {
+		countLen = writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, fields)
+	} else {
+		countLen = writeNULTerminatedLower(ctx, mod.Memory(), buf, bufLimit, fields, 2)
+	}
 
 	stack[0] = countLen
 }
 
+// rawHeaders returns true if handler.FeatureRawHeaders is enabled for the
+// current request or, during initialization, the guest.
+func (m *middleware) rawHeaders(ctx context.Context) bool {
+	if s, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
+		return s.features.IsEnabled(handler.FeatureRawHeaders)
+	}
+	return m.features.IsEnabled(handler.FeatureRawHeaders)
+}
+
+// deriveHeaders returns the result of handler.HeadersHost GetHeaders using
+// the names and values functions of handler.Host.
+func (m *middleware) deriveHeaders(ctx context.Context, kind handler.HeaderKind) (fields []string) {
+	var names []string
+	var values func(ctx context.Context, name string) []string
+	switch kind {
+	case handler.HeaderKindRequest:
+		names, values = m.host.GetRequestHeaderNames(ctx), m.host.GetRequestHeaderValues
+	case handler.HeaderKindRequestTrailers:
+		names, values = m.host.GetRequestTrailerNames(ctx), m.host.GetRequestTrailerValues
+	case handler.HeaderKindResponse:
+		names, values = m.host.GetResponseHeaderNames(ctx), m.host.GetResponseHeaderValues
+	case handler.HeaderKindResponseTrailers:
+		names, values = m.host.GetResponseTrailerNames(ctx), m.host.GetResponseTrailerValues
+	default:
+		panic("unsupported header kind: " + strconv.Itoa(int(kind)))
+	}
+
+	for _, n := range names {
+		for _, v := range values(ctx, n) {
+			fields = append(fields, n, v)
+		}
+	}
+	return
+}
+
 // getHeaderValues implements the WebAssembly host function
 // handler.FuncGetHeaderValues.
 func (m *middleware) getHeaderValues(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
@@ -519,37 +905,201 @@ func (m *middleware) removeHeader(ctx context.Context, mod wazeroapi.Module, par
 	}
 }
 
+// getQueryValues implements the WebAssembly host function
+// handler.FuncGetQueryValues.
+func (m *middleware) getQueryValues(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	name := uint32(stack[0])
+	nameLen := uint32(stack[1])
+	buf := uint32(stack[2])
+	bufLimit := handler.BufLimit(stack[3])
+
+	if nameLen == 0 {
+		panic("query parameter name cannot be empty")
+	}
+	h := m.mustQueryCookies(ctx, "get", "query values")
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+
+	values := h.GetQueryValues(ctx, n)
+	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, values)
+
+	stack[0] = countLen
+}
+
+// setQueryValue implements the WebAssembly host function
+// handler.FuncSetQueryValue.
+func (m *middleware) setQueryValue(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	name := uint32(params[0])
+	nameLen := uint32(params[1])
+	value := uint32(params[2])
+	valueLen := uint32(params[3])
+
+	if nameLen == 0 {
+		panic("query parameter name cannot be empty")
+	}
+	_ = mustBeforeNext(ctx, "set", "query value")
+	h := m.mustQueryCookies(ctx, "set", "query value")
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+	v := mustReadString(mod.Memory(), "value", value, valueLen)
+
+	h.SetQueryValue(ctx, n, v)
+}
+
+// removeQuery implements the WebAssembly host function
+// handler.FuncRemoveQuery.
+func (m *middleware) removeQuery(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	name := uint32(params[0])
+	nameLen := uint32(params[1])
+
+	if nameLen == 0 {
+		panic("query parameter name cannot be empty")
+	}
+	_ = mustBeforeNext(ctx, "remove", "query")
+	h := m.mustQueryCookies(ctx, "remove", "query")
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+
+	h.RemoveQuery(ctx, n)
+}
+
+// getCookieValues implements the WebAssembly host function
+// handler.FuncGetCookieValues.
+func (m *middleware) getCookieValues(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	name := uint32(stack[0])
+	nameLen := uint32(stack[1])
+	buf := uint32(stack[2])
+	bufLimit := handler.BufLimit(stack[3])
+
+	if nameLen == 0 {
+		panic("cookie name cannot be empty")
+	}
+	h := m.mustQueryCookies(ctx, "get", "cookie values")
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+
+	values := h.GetCookieValues(ctx, n)
+	countLen := writeNULTerminated(ctx, mod.Memory(), buf, bufLimit, values)
+
+	stack[0] = countLen
+}
+
+// setCookieValue implements the WebAssembly host function
+// handler.FuncSetCookieValue.
+func (m *middleware) setCookieValue(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	name := uint32(params[0])
+	nameLen := uint32(params[1])
+	value := uint32(params[2])
+	valueLen := uint32(params[3])
+
+	if nameLen == 0 {
+		panic("cookie name cannot be empty")
+	}
+	_ = mustBeforeNext(ctx, "set", "cookie value")
+	h := m.mustQueryCookies(ctx, "set", "cookie value")
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+	v := mustReadString(mod.Memory(), "value", value, valueLen)
+
+	h.SetCookieValue(ctx, n, v)
+}
+
+// removeCookie implements the WebAssembly host function
+// handler.FuncRemoveCookie.
+func (m *middleware) removeCookie(ctx context.Context, mod wazeroapi.Module, params []uint64) {
+	name := uint32(params[0])
+	nameLen := uint32(params[1])
+
+	if nameLen == 0 {
+		panic("cookie name cannot be empty")
+	}
+	_ = mustBeforeNext(ctx, "remove", "cookie")
+	h := m.mustQueryCookies(ctx, "remove", "cookie")
+	n := mustReadString(mod.Memory(), "name", name, nameLen)
+
+	h.RemoveCookie(ctx, n)
+}
+
+// mustQueryCookies returns the host as a handler.QueryCookiesHost or panics
+// if handler.FeatureQueryCookies isn't enabled for the current request.
+func (m *middleware) mustQueryCookies(ctx context.Context, op, kind string) handler.QueryCookiesHost {
+	if s := requestStateFromContext(ctx); !s.features.IsEnabled(handler.FeatureQueryCookies) {
+		panic(fmt.Errorf("can't %s %s unless %s is enabled", op, kind, handler.FeatureQueryCookies))
+	}
+	// FeatureQueryCookies can't be enabled unless the host implements this.
+	return m.host.(handler.QueryCookiesHost)
+}
+
 // readBody implements the WebAssembly host function handler.FuncReadBody.
 func (m *middleware) readBody(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
 	kind := handler.BodyKind(stack[0])
 	buf := uint32(stack[1])
 	bufLimit := handler.BufLimit(stack[2])
 
-	var r io.ReadCloser
+	_, r := m.bodyReader(ctx, kind, "read")
+
+	eofLen := readBody(mod, buf, bufLimit, r)
+
+	stack[0] = eofLen
+}
+
+// peekBody implements the WebAssembly host function handler.FuncPeekBody.
+func (m *middleware) peekBody(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	kind := handler.BodyKind(stack[0])
+	offset := uint32(stack[1])
+	buf := uint32(stack[2])
+	bufLimit := handler.BufLimit(stack[3])
+
+	// buf_limit 0 serves no purpose as implementations won't return EOF on it.
+	if bufLimit == 0 {
+		panic(fmt.Errorf("buf_limit==0 peeking body"))
+	}
+
+	s, r := m.bodyReader(ctx, kind, "peek")
+	p, ok := r.(handler.BodyPeeker)
+	if !ok {
+		// Peek by reading ahead, which consumes the host body. This is only
+		// safe for the request body when the host buffers it for the next
+		// handler.
+		if kind == handler.BodyKindRequest && !s.features.IsEnabled(handler.FeatureBufferRequest) {
+			panic(fmt.Errorf("can't peek request body unless %s is enabled", handler.FeatureBufferRequest))
+		}
+		pr := &peekingReader{delegate: r}
+		if kind == handler.BodyKindRequest {
+			s.requestBodyReader = pr
+		} else {
+			s.responseBodyReader = pr
+		}
+		p = pr
+	}
+
+	b := mustRead(mod.Memory(), "body", buf, bufLimit)
+	n, err := p.PeekAt(b, int64(offset))
+	if err == nil || n == len(b) {
+		stack[0] = uint64(n) // Not EOF
+	} else if err == io.EOF { // EOF is by contract, so can't be wrapped
+		stack[0] = uint64(1<<32) | uint64(n)
+	} else {
+		panic(fmt.Errorf("error peeking body: %w", err))
+	}
+}
+
+// bodyReader returns the reader of the body kind, lazy creating it.
+func (m *middleware) bodyReader(ctx context.Context, kind handler.BodyKind, op string) (s *requestState, r io.ReadCloser) {
 	switch kind {
 	case handler.BodyKindRequest:
-		s := mustBeforeNextOrFeature(ctx, handler.FeatureBufferRequest, "read", "request body")
-		// Lazy create the reader.
+		s = mustBeforeNextOrFeature(ctx, handler.FeatureBufferRequest, op, "request body")
 		r = s.requestBodyReader
 		if r == nil {
-			r = m.host.RequestBodyReader(ctx)
+			r = m.decodeBody(ctx, handler.BodyKindRequest, m.host.RequestBodyReader(ctx))
 			s.requestBodyReader = r
 		}
 	case handler.BodyKindResponse:
-		s := mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, "read", "response body")
-		// Lazy create the reader.
+		s = mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, op, "response body")
 		r = s.responseBodyReader
 		if r == nil {
-			r = m.host.ResponseBodyReader(ctx)
+			r = m.decodeBody(ctx, handler.BodyKindResponse, m.host.ResponseBodyReader(ctx))
 			s.responseBodyReader = r
 		}
 	default:
 		panic("unsupported body kind: " + strconv.Itoa(int(kind)))
 	}
-
-	eofLen := readBody(mod, buf, bufLimit, r)
-
-	stack[0] = eofLen
+	return
 }
 
 // writeBody implements the WebAssembly host function handler.FuncWriteBody.
@@ -565,7 +1115,7 @@ func (m *middleware) writeBody(ctx context.Context, mod wazeroapi.Module, params
 		// Lazy create the writer.
 		w = s.requestBodyWriter
 		if w == nil {
-			w = m.host.RequestBodyWriter(ctx)
+			w = m.encodeBody(ctx, handler.BodyKindRequest, m.host.RequestBodyWriter(ctx))
 			s.requestBodyWriter = w
 		}
 	case handler.BodyKindResponse:
@@ -573,7 +1123,8 @@ func (m *middleware) writeBody(ctx context.Context, mod wazeroapi.Module, params
 		// Lazy create the writer.
 		w = s.responseBodyWriter
 		if w == nil {
-			w = m.host.ResponseBodyWriter(ctx)
+			w = m.etagBody(ctx, m.host.ResponseBodyWriter(ctx))
+			w = m.encodeBody(ctx, handler.BodyKindResponse, w)
 			s.responseBodyWriter = w
 		}
 	default:
@@ -594,6 +1145,48 @@ func (m *middleware) getSourceAddr(ctx context.Context, mod wazeroapi.Module, st
 	stack[0] = uint64(methodLen)
 }
 
+// getHostError implements the WebAssembly host function
+// handler.FuncGetHostError.
+func (m *middleware) getHostError(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+	buf := uint32(stack[0])
+	bufLimit := handler.BufLimit(stack[1])
+
+	hostErr := requestStateFromContext(ctx).hostErr
+	if hostErr == nil {
+		stack[0] = 0
+		return
+	}
+	kind := errorKind(hostErr)
+	msgLen := writeStringIfUnderLimit(mod.Memory(), buf, bufLimit, hostErr.Error())
+
+	stack[0] = uint64(kind)<<32 | uint64(msgLen)
+}
+
+// isCanceled implements the WebAssembly host function handler.FuncIsCanceled.
+func (m *middleware) isCanceled(ctx context.Context, stack []uint64) {
+	if ctx.Err() != nil {
+		stack[0] = 1
+	} else {
+		stack[0] = 0
+	}
+}
+
+// errorKind returns the category of a non-nil host error.
+func errorKind(err error) handler.ErrorKind {
+	var kinded interface{ ErrorKind() handler.ErrorKind }
+	var netErr net.Error
+	switch {
+	case errors.As(err, &kinded):
+		return kinded.ErrorKind()
+	case errors.Is(err, context.Canceled):
+		return handler.ErrorKindCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return handler.ErrorKindTimeout
+	default:
+		return handler.ErrorKindUpstream
+	}
+}
+
 func writeBody(mod wazeroapi.Module, buf, bufLen uint32, w io.Writer) {
 	// buf_len 0 means to overwrite with nothing
 	var b []byte
@@ -618,11 +1211,27 @@ func (m *middleware) getStatusCode(ctx context.Context, results []uint64) {
 func (m *middleware) setStatusCode(ctx context.Context, params []uint64) {
 	statusCode := uint32(params[0])
 
-	_ = mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, "set", "status code")
+	_ = mustResponseHeadersMutable(ctx, "set", "status code")
 
 	m.host.SetStatusCode(ctx, statusCode)
 }
 
+// sendInformational implements the WebAssembly host function
+// handler.FuncSendInformational.
+func (m *middleware) sendInformational(ctx context.Context, params []uint64) {
+	statusCode := uint32(params[0])
+
+	s := mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, "send", "informational response")
+	if !s.features.IsEnabled(handler.FeatureInformational) {
+		panic(fmt.Errorf("can't send informational response unless %s is enabled", handler.FeatureInformational))
+	} else if statusCode < 100 || statusCode > 199 || statusCode == 101 {
+		panic(fmt.Errorf("invalid informational status code: %d", statusCode))
+	}
+
+	// FeatureInformational can't be enabled unless the host implements this.
+	m.host.(handler.InformationalHost).SendInformational(ctx, statusCode)
+}
+
 func readBody(mod wazeroapi.Module, buf uint32, bufLimit handler.BufLimit, r io.Reader) (eofLen uint64) {
 	// buf_limit 0 serves no purpose as implementations won't return EOF on it.
 	if bufLimit == 0 {
@@ -651,6 +1260,57 @@ func readBody(mod wazeroapi.Module, buf uint32, bufLimit handler.BufLimit, r io.
 	}
 }
 
+// unscopedFuncs are host functions guests can call outside a request, such
+// as during handler.FuncInit or handler.FuncTick.
+var unscopedFuncs = map[string]struct{}{
+	handler.FuncEnableFeatures: {},
+	handler.FuncGetConfig:      {},
+	handler.FuncLogEnabled:     {},
+	handler.FuncLog:            {},
+	handler.FuncIsCanceled:     {},
+}
+
+// hostModuleFunc returns the host function to export as the name, enforcing
+// the ImportPolicy and that request-scoped functions are called during a
+// request. Both panic, which traps the guest.
+func (m *middleware) hostModuleFunc(name string, fn wazeroapi.GoModuleFunc) wazeroapi.GoModuleFunc {
+	if !m.importPolicy.allows(name) {
+		return m.recordModuleFunc(name, func(context.Context, wazeroapi.Module, []uint64) { panicNotAllowed(name) })
+	}
+	if _, ok := unscopedFuncs[name]; ok {
+		return m.recordModuleFunc(name, fn)
+	}
+	return m.recordModuleFunc(name, func(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+		mustInRequest(ctx, name)
+		fn(ctx, mod, stack)
+	})
+}
+
+// hostFunc is like hostModuleFunc, except for host functions that don't use
+// the module.
+func (m *middleware) hostFunc(name string, fn wazeroapi.GoFunc) wazeroapi.GoFunc {
+	if !m.importPolicy.allows(name) {
+		return m.recordFunc(name, func(context.Context, []uint64) { panicNotAllowed(name) })
+	}
+	if _, ok := unscopedFuncs[name]; ok {
+		return m.recordFunc(name, fn)
+	}
+	return m.recordFunc(name, func(ctx context.Context, stack []uint64) {
+		mustInRequest(ctx, name)
+		fn(ctx, stack)
+	})
+}
+
+func panicNotAllowed(name string) {
+	panic(fmt.Errorf("can't call %s as the import policy doesn't allow it", name))
+}
+
+func mustInRequest(ctx context.Context, name string) {
+	if _, ok := ctx.Value(requestStateKey{}).(*requestState); !ok {
+		panic(fmt.Errorf("can't call %s outside a request", name))
+	}
+}
+
 func mustBeforeNext(ctx context.Context, op, kind string) (s *requestState) {
 	if s = requestStateFromContext(ctx); s.afterNext {
 		panic(fmt.Errorf("can't %s %s after next handler", op, kind))
@@ -675,65 +1335,120 @@ const i32, i64 = wazeroapi.ValueTypeI32, wazeroapi.ValueTypeI64
 func (m *middleware) instantiateHost(ctx context.Context) (wazeroapi.Module, error) {
 	return m.runtime.NewHostModuleBuilder(handler.HostModule).
 		NewFunctionBuilder().
-		WithGoFunction(wazeroapi.GoFunc(m.enableFeatures), []wazeroapi.ValueType{i32}, []wazeroapi.ValueType{i32}).
+		WithGoFunction(m.hostFunc(handler.FuncEnableFeatures, m.enableFeatures), []wazeroapi.ValueType{i32}, []wazeroapi.ValueType{i32}).
 		WithParameterNames("features").Export(handler.FuncEnableFeatures).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getConfig), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncGetConfig, m.getConfig), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
 		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetConfig).
 		NewFunctionBuilder().
-		WithGoFunction(wazeroapi.GoFunc(m.logEnabled), []wazeroapi.ValueType{i32}, []wazeroapi.ValueType{i32}).
+		WithGoFunction(m.hostFunc(handler.FuncLogEnabled, m.logEnabled), []wazeroapi.ValueType{i32}, []wazeroapi.ValueType{i32}).
 		WithParameterNames("level").Export(handler.FuncLogEnabled).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.log), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncLog, m.log), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{}).
 		WithParameterNames("level", "message", "message_len").Export(handler.FuncLog).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getMethod), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncGetMethod, m.getMethod), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
 		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetMethod).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.setMethod), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncSetMethod, m.setMethod), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{}).
 		WithParameterNames("method", "method_len").Export(handler.FuncSetMethod).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getURI), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncGetURI, m.getURI), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
 		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetURI).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.setURI), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncSetURI, m.setURI), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{}).
 		WithParameterNames("uri", "uri_len").Export(handler.FuncSetURI).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getProtocolVersion), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncGetAuthority, m.getAuthority), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetAuthority).
+		NewFunctionBuilder().
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncSetAuthority, m.setAuthority), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("authority", "authority_len").Export(handler.FuncSetAuthority).
+		NewFunctionBuilder().
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncGetScheme, m.getScheme), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetScheme).
+		NewFunctionBuilder().
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncSetScheme, m.setScheme), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("scheme", "scheme_len").Export(handler.FuncSetScheme).
+		NewFunctionBuilder().
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncGetProtocolVersion, m.getProtocolVersion), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
 		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetProtocolVersion).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getHeaderNames), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{i64}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncGetHeaderNames, m.getHeaderNames), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{i64}).
 		WithParameterNames("kind", "buf", "buf_limit").Export(handler.FuncGetHeaderNames).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getHeaderValues), []wazeroapi.ValueType{i32, i32, i32, i32, i32}, []wazeroapi.ValueType{i64}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncGetHeaderValues, m.getHeaderValues), []wazeroapi.ValueType{i32, i32, i32, i32, i32}, []wazeroapi.ValueType{i64}).
 		WithParameterNames("kind", "name", "name_len", "buf", "buf_limit").Export(handler.FuncGetHeaderValues).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.setHeaderValue), []wazeroapi.ValueType{i32, i32, i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncGetHeaders, m.getHeaders), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("kind", "buf", "buf_limit").Export(handler.FuncGetHeaders).
+		NewFunctionBuilder().
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncSetHeaderValue, m.setHeaderValue), []wazeroapi.ValueType{i32, i32, i32, i32, i32}, []wazeroapi.ValueType{}).
 		WithParameterNames("kind", "name", "name_len", "value", "value_len").Export(handler.FuncSetHeaderValue).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.addHeaderValue), []wazeroapi.ValueType{i32, i32, i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncAddHeaderValue, m.addHeaderValue), []wazeroapi.ValueType{i32, i32, i32, i32, i32}, []wazeroapi.ValueType{}).
 		WithParameterNames("kind", "name", "name_len", "value", "value_len").Export(handler.FuncAddHeaderValue).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.removeHeader), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncRemoveHeader, m.removeHeader), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{}).
 		WithParameterNames("kind", "name", "name_len").Export(handler.FuncRemoveHeader).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.readBody), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{i64}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncGetQueryValues, m.getQueryValues), []wazeroapi.ValueType{i32, i32, i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("name", "name_len", "buf", "buf_limit").Export(handler.FuncGetQueryValues).
+		NewFunctionBuilder().
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncSetQueryValue, m.setQueryValue), []wazeroapi.ValueType{i32, i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("name", "name_len", "value", "value_len").Export(handler.FuncSetQueryValue).
+		NewFunctionBuilder().
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncRemoveQuery, m.removeQuery), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("name", "name_len").Export(handler.FuncRemoveQuery).
+		NewFunctionBuilder().
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncGetCookieValues, m.getCookieValues), []wazeroapi.ValueType{i32, i32, i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("name", "name_len", "buf", "buf_limit").Export(handler.FuncGetCookieValues).
+		NewFunctionBuilder().
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncSetCookieValue, m.setCookieValue), []wazeroapi.ValueType{i32, i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("name", "name_len", "value", "value_len").Export(handler.FuncSetCookieValue).
+		NewFunctionBuilder().
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncRemoveCookie, m.removeCookie), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("name", "name_len").Export(handler.FuncRemoveCookie).
+		NewFunctionBuilder().
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncReadBody, m.readBody), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{i64}).
 		WithParameterNames("kind", "buf", "buf_limit").Export(handler.FuncReadBody).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.writeBody), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncPeekBody, m.peekBody), []wazeroapi.ValueType{i32, i32, i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("kind", "offset", "buf", "buf_limit").Export(handler.FuncPeekBody).
+		NewFunctionBuilder().
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncWriteBody, m.writeBody), []wazeroapi.ValueType{i32, i32, i32}, []wazeroapi.ValueType{}).
 		WithParameterNames("kind", "body", "body_len").Export(handler.FuncWriteBody).
 		NewFunctionBuilder().
-		WithGoModuleFunction(wazeroapi.GoModuleFunc(m.getSourceAddr), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncGetSourceAddr, m.getSourceAddr), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i32}).
 		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetSourceAddr).
 		NewFunctionBuilder().
-		WithGoFunction(wazeroapi.GoFunc(m.getStatusCode), []wazeroapi.ValueType{}, []wazeroapi.ValueType{i32}).
+		WithGoModuleFunction(m.hostModuleFunc(handler.FuncGetHostError, m.getHostError), []wazeroapi.ValueType{i32, i32}, []wazeroapi.ValueType{i64}).
+		WithParameterNames("buf", "buf_limit").Export(handler.FuncGetHostError).
+		NewFunctionBuilder().
+		WithGoFunction(m.hostFunc(handler.FuncIsCanceled, m.isCanceled), []wazeroapi.ValueType{}, []wazeroapi.ValueType{i32}).
+		WithParameterNames().Export(handler.FuncIsCanceled).
+		NewFunctionBuilder().
+		WithGoFunction(m.hostFunc(handler.FuncGetStatusCode, m.getStatusCode), []wazeroapi.ValueType{}, []wazeroapi.ValueType{i32}).
 		WithParameterNames().Export(handler.FuncGetStatusCode).
 		NewFunctionBuilder().
-		WithGoFunction(wazeroapi.GoFunc(m.setStatusCode), []wazeroapi.ValueType{i32}, []wazeroapi.ValueType{}).
+		WithGoFunction(m.hostFunc(handler.FuncSetStatusCode, m.setStatusCode), []wazeroapi.ValueType{i32}, []wazeroapi.ValueType{}).
 		WithParameterNames("status_code").Export(handler.FuncSetStatusCode).
+		NewFunctionBuilder().
+		WithGoFunction(m.hostFunc(handler.FuncSendInformational, m.sendInformational), []wazeroapi.ValueType{i32}, []wazeroapi.ValueType{}).
+		WithParameterNames("status_code").Export(handler.FuncSendInformational).
 		Instantiate(ctx)
 }
 
+// mustResponseHeadersMutable is like mustBeforeNextOrFeature with
+// handler.FeatureBufferResponse, except it also allows changes during
+// handler.FuncHandleResponseHeaders.
+func mustResponseHeadersMutable(ctx context.Context, op, kind string) (s *requestState) {
+	if s = requestStateFromContext(ctx); s.inResponseHeaders {
+		return
+	}
+	return mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, op, kind)
+}
+
 func mustHeaderMutable(ctx context.Context, op string, kind handler.HeaderKind) {
 	switch kind {
 	case handler.HeaderKindRequest:
@@ -741,7 +1456,7 @@ func mustHeaderMutable(ctx context.Context, op string, kind handler.HeaderKind)
 	case handler.HeaderKindRequestTrailers:
 		_ = mustBeforeNext(ctx, op, "request trailer")
 	case handler.HeaderKindResponse:
-		_ = mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, op, "response header")
+		_ = mustResponseHeadersMutable(ctx, op, "response header")
 	case handler.HeaderKindResponseTrailers:
 		_ = mustBeforeNextOrFeature(ctx, handler.FeatureBufferResponse, op, "response trailer")
 	default:
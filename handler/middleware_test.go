@@ -1,16 +1,31 @@
 package handler
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ed25519"
 	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
 	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
 
+	"github.com/http-wasm/http-wasm-host-go/api"
 	"github.com/http-wasm/http-wasm-host-go/api/handler"
 	"github.com/http-wasm/http-wasm-host-go/internal/test"
+	"github.com/http-wasm/http-wasm-host-go/verify"
 )
 
 var testCtx = context.Background()
@@ -48,6 +63,268 @@ wasm stack trace:
 	}
 }
 
+func TestMiddlewareReactor(t *testing.T) {
+	mw, err := NewMiddleware(testCtx, test.BinE2EReactor, handler.UnimplementedHost{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	// The guest only proceeds to the next handler once initialized.
+	_, ctxNext, err := mw.HandleRequest(testCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := handler.CtxNext(1), ctxNext; want != have {
+		t.Errorf("unexpected ctxNext, want: %d, have: %d", want, have)
+	}
+}
+
+func TestMiddlewareInit(t *testing.T) {
+	tests := []struct {
+		name          string
+		guestConfig   string
+		expectedError string
+	}{
+		{
+			name: "ok",
+		},
+		{
+			name:          "error",
+			guestConfig:   "invalid rate: -1",
+			expectedError: "invalid rate: -1",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := NewMiddleware(testCtx, test.BinE2ELifecycle, handler.UnimplementedHost{},
+				GuestConfig([]byte(tc.guestConfig)))
+			if tc.expectedError == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				mw.Close(testCtx)
+				return
+			}
+
+			var initErr *InitError
+			if !errors.As(err, &initErr) {
+				t.Fatalf("expected InitError, have: %v", err)
+			}
+			if want, have := tc.expectedError, initErr.Message; want != have {
+				t.Errorf("unexpected message, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
+
+func TestMiddlewareShutdown(t *testing.T) {
+	logger := &bufferLogger{}
+	mw, err := NewMiddleware(testCtx, test.BinE2ELifecycle, handler.UnimplementedHost{}, Logger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// NewMiddleware eagerly adds an instance to the pool, which is shut down.
+	if err = mw.Close(testCtx); err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "shutdown\n", logger.String(); want != have {
+		t.Errorf("unexpected logs, want: %q, have: %q", want, have)
+	}
+}
+
+func TestMiddlewareShutdown_Evicted(t *testing.T) {
+	logger := make(chanLogger, 2)
+	mw, err := NewMiddleware(testCtx, test.BinE2ELifecycle, handler.UnimplementedHost{}, Logger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate the pool evicting its instance, which is then shut down. The
+	// pool is replaced, as sync.Pool.Get may not return the instance.
+	mw.(*middleware).pool = sync.Pool{}
+	runtime.GC()
+	select {
+	case message := <-logger:
+		if want, have := "shutdown", message; want != have {
+			t.Errorf("unexpected log, want: %q, have: %q", want, have)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("evicted instance wasn't shut down")
+	}
+
+	// The evicted instance isn't shut down again.
+	if err = mw.Close(testCtx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case message := <-logger:
+		t.Errorf("unexpected log: %q", message)
+	default:
+	}
+}
+
+func TestMiddlewareTick(t *testing.T) {
+	tests := []struct {
+		name            string
+		guest           []byte
+		expectedMessage string
+	}{
+		{
+			name:            "ok",
+			guest:           test.BinE2ETick,
+			expectedMessage: "tick",
+		},
+		{
+			name:            "request scoped",
+			guest:           test.BinErrorGetMethodOnTick,
+			expectedMessage: "can't call get_method outside a request",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			logger := make(chanLogger, 10)
+			mw, err := NewMiddleware(testCtx, tc.guest, handler.UnimplementedHost{},
+				Logger(logger), TickInterval(time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			// Ticks continue after an error, so wait for more than one.
+			for i := 0; i < 2; i++ {
+				select {
+				case message := <-logger:
+					if !strings.Contains(message, tc.expectedMessage) {
+						t.Fatalf("expected message to contain %q, have: %q", tc.expectedMessage, message)
+					}
+				case <-time.After(time.Second):
+					t.Fatal("timeout waiting for tick")
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareGuestOutput(t *testing.T) {
+	tests := []struct {
+		name         string
+		guest        []byte
+		ctx          context.Context
+		expectedLogs string
+	}{
+		{
+			name:         "request",
+			guest:        test.BinErrorPanicOnHandleRequest,
+			ctx:          testCtx,
+			expectedLogs: "panic_on_handle_request: panic!\n",
+		},
+		{
+			name:         "request ID",
+			guest:        test.BinErrorPanicOnHandleRequest,
+			ctx:          api.WithRequestID(testCtx, "7f3a"),
+			expectedLogs: "panic_on_handle_request [7f3a]: panic!\n",
+		},
+		{
+			name:         "_start",
+			guest:        test.BinErrorPanicOnStart,
+			ctx:          api.WithRequestID(testCtx, "7f3a"),
+			expectedLogs: "panic_on_start [7f3a]: panic!\n",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			logger := &bufferLogger{}
+			mw, err := NewMiddleware(tc.ctx, tc.guest, handler.UnimplementedHost{},
+				Logger(logger), GuestOutput(api.LogLevelInfo, api.LogLevelError))
+			if err == nil {
+				defer mw.Close(testCtx)
+				_, _, _ = mw.HandleRequest(tc.ctx)
+			}
+
+			if want, have := tc.expectedLogs, logger.String(); want != have {
+				t.Errorf("unexpected logs, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
+
+// chanLogger sends all log messages to the channel, dropping them when full.
+type chanLogger chan string
+
+func (chanLogger) IsEnabled(api.LogLevel) bool {
+	return true
+}
+
+func (l chanLogger) Log(_ context.Context, _ api.LogLevel, message string) {
+	select {
+	case l <- message:
+	default:
+	}
+}
+
+func TestMiddlewareVerify(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := verify.Embedded(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		guest            []byte
+		expectedUnsigned bool
+		expectedInvalid  bool
+	}{
+		{
+			name:  "signed",
+			guest: verify.Embed(test.BinE2EMethod, ed25519.Sign(priv, test.BinE2EMethod)),
+		},
+		{
+			name:             "unsigned",
+			guest:            test.BinE2EMethod,
+			expectedUnsigned: true,
+		},
+		{
+			name:            "invalid",
+			guest:           verify.Embed(test.BinE2EMethod, ed25519.Sign(priv, test.BinE2EURI)),
+			expectedInvalid: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := NewMiddleware(testCtx, tc.guest, handler.UnimplementedHost{}, Verify(verifier))
+			if !tc.expectedUnsigned && !tc.expectedInvalid {
+				if err != nil {
+					t.Fatal(err)
+				}
+				mw.Close(testCtx)
+				return
+			}
+
+			var sigErr *verify.SignatureError
+			if !errors.As(err, &sigErr) {
+				t.Fatalf("expected SignatureError, have: %v", err)
+			}
+			if want, have := tc.expectedUnsigned, sigErr.Unsigned; want != have {
+				t.Errorf("unexpected unsigned, want: %v, have: %v", want, have)
+			}
+		})
+	}
+}
+
 type UnimplementedHostWithBufferFeature struct {
 	handler.UnimplementedHost
 }
@@ -104,6 +381,90 @@ wasm stack trace:
 	}
 }
 
+func TestMiddlewareHandleRequest_Canceled(t *testing.T) {
+	mw, err := NewMiddleware(testCtx, test.BinErrorLoopOnHandleRequest, handler.UnimplementedHost{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	ctx, cancel := context.WithTimeout(testCtx, 50*time.Millisecond)
+	defer cancel()
+
+	// The guest loops forever, so only cancellation can stop it.
+	_, _, err = mw.HandleRequest(ctx)
+	if err == nil || !strings.Contains(err.Error(), "context deadline exceeded") {
+		t.Fatalf("expected context deadline exceeded, have: %v", err)
+	}
+
+	// The interrupted guest must not be reused.
+	pool := &mw.(*middleware).pool
+	for g, ok := pool.Get().(*guest); ok; g, ok = pool.Get().(*guest) {
+		if g.guest.IsClosed() {
+			t.Fatal("closed guest was put back into the pool")
+		}
+	}
+}
+
+// TestMiddlewareHandleRequest_CanceledNewGuest ensures a canceled request
+// doesn't abort instantiating a guest, and that failing to instantiate one
+// doesn't break the middleware.
+func TestMiddlewareHandleRequest_CanceledNewGuest(t *testing.T) {
+	mw, err := NewMiddleware(testCtx, test.BinErrorPanicOnStartCanceled, handler.UnimplementedHost{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+	m := mw.(*middleware)
+
+	// Take the first guest, named "1", so that the canceled request
+	// instantiates another.
+	first := m.pool.Get()
+	ctx, cancel := context.WithCancel(testCtx)
+	cancel()
+	if _, _, err = mw.HandleRequest(ctx); err != nil && strings.Contains(err.Error(), "instantiating") {
+		t.Fatalf("unexpected error instantiating the guest: %v", err)
+	}
+
+	// Fail to instantiate a guest, by reusing the name of the first.
+	atomic.StoreUint64(&m.instanceCounter, 0)
+	if _, err = m.newGuest(testCtx); err == nil {
+		t.Fatal("expected an error instantiating the guest")
+	}
+
+	// The next request instantiates a guest, so the runtime must be open.
+	atomic.StoreUint64(&m.instanceCounter, 100)
+	for m.pool.Get() != nil {
+	}
+	if _, _, err = mw.HandleRequest(testCtx); err != nil {
+		t.Fatal(err)
+	}
+	m.pool.Put(first)
+}
+
+func TestMiddlewareIsCanceled(t *testing.T) {
+	// Don't abort the guest on cancellation, so it can stop on its own.
+	newRuntime := func(ctx context.Context) (wazero.Runtime, error) {
+		return wazero.NewRuntime(ctx), nil
+	}
+	mw, err := NewMiddleware(testCtx, test.BinE2EIsCanceled, handler.UnimplementedHost{}, Runtime(newRuntime))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	ctx, cancel := context.WithCancel(testCtx)
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	_, ctxNext, err := mw.HandleRequest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctxNext != 0 {
+		t.Errorf("expected the guest to skip the next handler, have: %d", ctxNext)
+	}
+}
+
 func TestMiddlewareHandleResponse_Error(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -184,6 +545,361 @@ func TestMiddlewareResponseUsesRequestModule(t *testing.T) {
 	requireGlobals(t, mw, 44, 43)
 }
 
+// headersHost doesn't implement handler.HeadersHost, so the result of
+// handler.FuncGetHeaders is derived from the names and values functions.
+type headersHost struct {
+	handler.UnimplementedHost
+	names  []string
+	values map[string][]string
+	body   *bytes.Buffer
+}
+
+func (h headersHost) GetRequestHeaderNames(context.Context) []string { return h.names }
+
+func (h headersHost) GetRequestHeaderValues(_ context.Context, name string) []string {
+	return h.values[name]
+}
+
+func (h headersHost) ResponseBodyWriter(context.Context) io.Writer { return h.body }
+
+func TestMiddlewareGetHeaders_Derived(t *testing.T) {
+	host := headersHost{
+		names:  []string{"Host", "Set-Cookie"},
+		values: map[string][]string{"Host": {"localhost"}, "Set-Cookie": {"a=b", "c=d"}},
+		body:   &bytes.Buffer{},
+	}
+
+	mw, err := NewMiddleware(testCtx, test.BinE2EHeaders, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	if _, ctxNext, err := mw.HandleRequest(testCtx); err != nil {
+		t.Fatal(err)
+	} else if ctxNext != 0 {
+		t.Errorf("unexpected ctxNext, want: 0, have: %d", ctxNext)
+	}
+
+	want := "host\x00localhost\x00set-cookie\x00a=b\x00set-cookie\x00c=d\x00"
+	if have := host.body.String(); want != have {
+		t.Errorf("unexpected fields, want: %q, have: %q", want, have)
+	}
+}
+
+// rawHeadersHost is a headersHost that supports handler.FeatureRawHeaders.
+type rawHeadersHost struct {
+	headersHost
+}
+
+func (rawHeadersHost) EnableFeatures(_ context.Context, features handler.Features) handler.Features {
+	return features
+}
+
+func TestMiddlewareGetHeaders_Raw(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      bool
+		options  []Option
+		expected string
+	}{
+		{
+			name:     "unsupported",
+			expected: "x-b\x00b\x00host\x00localhost\x00x-a\x00a\x00",
+		},
+		{
+			name:     "supported",
+			raw:      true,
+			expected: "X-B\x00b\x00Host\x00localhost\x00x-A\x00a\x00",
+		},
+		{
+			name:     "not allowed",
+			raw:      true,
+			options:  []Option{AllowFeatures(handler.FeatureBufferRequest)},
+			expected: "x-b\x00b\x00host\x00localhost\x00x-a\x00a\x00",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			body := &bytes.Buffer{}
+			var host handler.Host = headersHost{
+				names:  []string{"X-B", "Host", "x-A"},
+				values: map[string][]string{"X-B": {"b"}, "Host": {"localhost"}, "x-A": {"a"}},
+				body:   body,
+			}
+			if tc.raw {
+				host = rawHeadersHost{host.(headersHost)}
+			}
+
+			mw, err := NewMiddleware(testCtx, test.BinE2ERawHeaders, host, tc.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			if _, _, err = mw.HandleRequest(testCtx); err != nil {
+				t.Fatal(err)
+			}
+
+			if want, have := tc.expected, body.String(); want != have {
+				t.Errorf("unexpected fields, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
+
+// TestMiddlewareQueryCookies_Unsupported ensures handler.FeatureQueryCookies
+// can't be enabled unless the host implements handler.QueryCookiesHost.
+func TestMiddlewareQueryCookies_Unsupported(t *testing.T) {
+	body := &bytes.Buffer{}
+	// rawHeadersHost returns all features requested, but doesn't implement
+	// handler.QueryCookiesHost.
+	host := rawHeadersHost{headersHost{body: body}}
+
+	mw, err := NewMiddleware(testCtx, test.BinE2EQueryCookies, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	if _, _, err = mw.HandleRequest(testCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	if want, have := "unsupported", body.String(); want != have {
+		t.Errorf("unexpected body, want: %q, have: %q", want, have)
+	}
+}
+
+func TestMiddlewareResponseHeaders_Unsupported(t *testing.T) {
+	tests := []struct {
+		name        string
+		guest       []byte
+		unsupported bool
+	}{
+		{name: "exported", guest: test.BinE2EResponseHeaders},
+		{name: "not exported", guest: test.BinE2EHandleResponse, unsupported: true},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := NewMiddleware(testCtx, tc.guest, rawHeadersHost{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			unsupported := mw.(*middleware).unsupportedFeatures
+			if want, have := tc.unsupported, unsupported.IsEnabled(handler.FeatureResponseHeaders); want != have {
+				t.Errorf("unexpected unsupported, want: %v, have: %v", want, have)
+			}
+		})
+	}
+}
+
+// bufferLogger writes all log messages to a buffer, one per line.
+type bufferLogger struct {
+	bytes.Buffer
+}
+
+func (*bufferLogger) IsEnabled(api.LogLevel) bool {
+	return true
+}
+
+func (l *bufferLogger) Log(_ context.Context, _ api.LogLevel, message string) {
+	l.WriteString(message + "\n")
+}
+
+// encodedBodyHost returns a request body with a "Content-Encoding". Any
+// request header set by the guest is written to peeked.
+type encodedBodyHost struct {
+	handler.UnimplementedHost
+	body, encoding string
+	peeked         *string
+}
+
+func (h encodedBodyHost) GetRequestHeaderValues(_ context.Context, name string) []string {
+	if name == "Content-Encoding" {
+		return []string{h.encoding}
+	}
+	return nil
+}
+
+func (h encodedBodyHost) RequestBodyReader(context.Context) io.ReadCloser {
+	return io.NopCloser(strings.NewReader(h.body))
+}
+
+func (h encodedBodyHost) SetRequestHeaderValue(_ context.Context, _, value string) {
+	*h.peeked = value
+}
+
+func TestDecodeContent_Unknown(t *testing.T) {
+	for _, policy := range []ContentEncodingPolicy{0, ContentEncodingDrop + 1} {
+		_, err := NewMiddleware(testCtx, test.BinE2EProtocolVersion, handler.UnimplementedHost{}, DecodeContent(policy))
+		requireEqualError(t, err, fmt.Sprintf("wasm: unknown ContentEncodingPolicy %d", policy))
+	}
+}
+
+func TestMiddlewareDecodeContent_Unsupported(t *testing.T) {
+	host := encodedBodyHost{body: "hello world", encoding: "compress"}
+	logger := &bufferLogger{}
+	mw, err := NewMiddleware(testCtx, test.BinBenchReadBody, host, DecodeContent(ContentEncodingReencode), Logger(logger))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	// The guest traps unless it reads the body as-is.
+	if _, _, err = mw.HandleRequest(testCtx); err != nil {
+		t.Fatal(err)
+	}
+	want := "guest reads the request body as-is, as its Content-Encoding \"compress\" isn't supported\n"
+	if have := logger.String(); want != have {
+		t.Errorf("unexpected log, want: %q, have: %q", want, have)
+	}
+}
+
+func TestMiddlewareInformational_Unsupported(t *testing.T) {
+	// rawHeadersHost returns all features requested, but doesn't implement
+	// handler.InformationalHost.
+	mw, err := NewMiddleware(testCtx, test.BinE2EInformational, rawHeadersHost{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	// The guest traps when it can't enable handler.FeatureInformational.
+	if _, _, err = mw.HandleRequest(testCtx); err == nil || !strings.Contains(err.Error(), "unreachable") {
+		t.Errorf("expected unreachable, have: %v", err)
+	}
+}
+
+func Test_errorKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected handler.ErrorKind
+	}{
+		{name: "panic", err: &handler.PanicError{Value: "oops!"}, expected: handler.ErrorKindPanic},
+		{name: "panic error", err: &handler.PanicError{Value: context.Canceled}, expected: handler.ErrorKindPanic},
+		{name: "canceled", err: fmt.Errorf("proxy: %w", context.Canceled), expected: handler.ErrorKindCanceled},
+		{name: "deadline", err: context.DeadlineExceeded, expected: handler.ErrorKindTimeout},
+		{name: "net timeout", err: &net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}, expected: handler.ErrorKindTimeout},
+		{name: "other", err: io.ErrUnexpectedEOF, expected: handler.ErrorKindUpstream},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			if want, have := tc.expected, errorKind(tc.err); want != have {
+				t.Errorf("unexpected kind, want: %d, have: %d", want, have)
+			}
+		})
+	}
+}
+
+// bodyHost returns a request body that doesn't implement handler.BodyPeeker.
+type bodyHost struct {
+	handler.UnimplementedHost
+	body string
+}
+
+func (h bodyHost) RequestBodyReader(context.Context) io.ReadCloser {
+	return io.NopCloser(strings.NewReader(h.body))
+}
+
+func TestMiddlewarePeekBody_ReadAhead(t *testing.T) {
+	tests := []struct {
+		name          string
+		features      handler.Features
+		expectedError string
+	}{
+		{
+			name:          "unbuffered",
+			expectedError: "can't peek request body unless buffer_request is enabled",
+		},
+		{
+			name:     "buffered",
+			features: handler.FeatureBufferRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := NewMiddleware(testCtx, test.BinE2EPeekBody, bodyHost{body: "hello world"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+			mw.(*middleware).features = tc.features
+
+			_, _, err = mw.HandleRequest(testCtx)
+			if tc.expectedError == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Errorf("expected error to contain %q, have: %v", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestMiddlewarePeekBody_DecodeContent(t *testing.T) {
+	var gzipped bytes.Buffer
+	w := gzip.NewWriter(&gzipped)
+	w.Write([]byte("hello world")) // nolint
+	w.Close()                      // nolint
+
+	tests := []struct {
+		name           string
+		features       handler.Features
+		expectedPeeked string
+		expectedError  string
+	}{
+		{
+			// Decoders read ahead, so peeking would consume the host body.
+			name:          "unbuffered",
+			expectedError: "can't peek request body unless buffer_request is enabled",
+		},
+		{
+			name:           "buffered",
+			features:       handler.FeatureBufferRequest,
+			expectedPeeked: "world",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			var peeked string
+			host := encodedBodyHost{body: gzipped.String(), encoding: "gzip", peeked: &peeked}
+			mw, err := NewMiddleware(testCtx, test.BinE2EPeekBody, host, DecodeContent(ContentEncodingReencode))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+			mw.(*middleware).features = tc.features
+
+			_, _, err = mw.HandleRequest(testCtx)
+			if tc.expectedError == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Errorf("expected error to contain %q, have: %v", tc.expectedError, err)
+			}
+			if want, have := tc.expectedPeeked, peeked; want != have {
+				t.Errorf("unexpected peeked, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
+
 func requireGlobals(t *testing.T, mw Middleware, wantGlobals ...uint64) {
 	t.Helper()
 	if want, have := wantGlobals, getGlobalVals(mw); !reflect.DeepEqual(want, have) {
@@ -192,7 +908,7 @@ func requireGlobals(t *testing.T, mw Middleware, wantGlobals ...uint64) {
 }
 
 func getGlobalVals(mw Middleware) []uint64 {
-	pool := mw.(*middleware).pool
+	pool := &mw.(*middleware).pool
 	var guests []*guest
 	var globals []uint64
 
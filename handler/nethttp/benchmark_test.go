@@ -133,6 +133,18 @@ var benches = map[string]struct {
 		bin:     test.BinBenchGetHeaderNames,
 		request: getWithLargeHeader,
 	},
+	"get_headers none": {
+		bin:     test.BinBenchGetHeaders,
+		request: getWithoutHeaders,
+	},
+	"get_headers": {
+		bin:     test.BinBenchGetHeaders,
+		request: get,
+	},
+	"get_headers large": {
+		bin:     test.BinBenchGetHeaders,
+		request: getWithLargeHeader,
+	},
 	"get_header_values exists": {
 		bin:     test.BinBenchGetHeaderValues,
 		request: get,
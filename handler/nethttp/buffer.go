@@ -4,34 +4,93 @@ import (
 	"bytes"
 	"io"
 	"net/http"
+	"strconv"
 )
 
+// bufferingRequestBody is the request body read by the guest. It buffers what
+// the next handler must read before the rest of the delegate: only peeked
+// bytes, unless retain is set by handler.FeatureBufferRequest.
 type bufferingRequestBody struct {
 	delegate io.ReadCloser
-	buffer   bytes.Buffer
+	buffer   []byte
+	// pos is the count of bytes in buffer already read by the guest.
+	pos int
+	// retain is true when the next handler reads what the guest did.
+	retain bool
 }
 
-// Read buffers anything read from the delegate.
+// Read reads any buffered bytes before the delegate, buffering what's read
+// from the delegate if retain is set.
 func (b *bufferingRequestBody) Read(p []byte) (n int, err error) {
-	n, err = b.delegate.Read(p)
-	if err != nil && n > 0 {
-		b.buffer.Write(p[0:n])
+	if b.pos < len(b.buffer) {
+		n = copy(p, b.buffer[b.pos:])
+	} else if n, err = b.delegate.Read(p); b.retain {
+		b.buffer = append(b.buffer, p[:n]...)
+	} else {
+		return // nothing to buffer
+	}
+	b.pos += n
+	if !b.retain && b.pos == len(b.buffer) { // release peeked bytes
+		b.buffer, b.pos = b.buffer[:0], 0
 	}
 	return
 }
 
-// Close dispatches to the delegate.
-func (b *bufferingRequestBody) Close() (err error) {
-	if b.delegate != nil {
-		err = b.delegate.Close()
+// PeekAt implements handler.BodyPeeker by buffering from the delegate until
+// the buffer includes p.
+func (b *bufferingRequestBody) PeekAt(p []byte, off int64) (n int, err error) {
+	start := b.pos + int(off)
+	if length := start + len(p); len(b.buffer) < length {
+		if cap(b.buffer) < length {
+			grown := make([]byte, len(b.buffer), length)
+			copy(grown, b.buffer)
+			b.buffer = grown
+		}
+		for len(b.buffer) < length && err == nil {
+			var nn int
+			nn, err = b.delegate.Read(b.buffer[len(b.buffer):length])
+			b.buffer = b.buffer[:len(b.buffer)+nn]
+		}
+	}
+	if start < len(b.buffer) {
+		n = copy(p, b.buffer[start:])
+	}
+	if n == len(p) {
+		err = nil
 	}
 	return
 }
 
+// Close doesn't close the delegate, as the next handler reads any remaining
+// request body after what was buffered.
+func (b *bufferingRequestBody) Close() error {
+	return nil
+}
+
+// nextBody returns the body the next handler should read: what's buffered,
+// followed by what's remaining in the delegate.
+func (b *bufferingRequestBody) nextBody() io.ReadCloser {
+	buffered := b.buffer
+	if !b.retain {
+		buffered = buffered[b.pos:]
+	}
+	if len(buffered) == 0 {
+		return b.delegate
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buffered), b.delegate), b.delegate}
+}
+
 type bufferingResponseWriter struct {
 	delegate   http.ResponseWriter
 	statusCode uint32
 	body       []byte
+
+	// rewritten is true when the guest replaced the body of the next
+	// handler.
+	rewritten bool
 }
 
 // Header dispatches to the delegate.
@@ -45,13 +104,23 @@ func (w *bufferingResponseWriter) Write(bytes []byte) (int, error) {
 	return len(bytes), nil
 }
 
-// WriteHeader buffers the status code.
+// WriteHeader buffers the status code. Informational (1xx) status codes are
+// dispatched to the delegate, as they precede the response.
 func (w *bufferingResponseWriter) WriteHeader(statusCode int) {
+	if statusCode < 200 {
+		w.delegate.WriteHeader(statusCode)
+		return
+	}
 	w.statusCode = uint32(statusCode)
 }
 
 // release sends any response data collected.
 func (w *bufferingResponseWriter) release() {
+	// If the guest rewrote the body, its length is likely different.
+	if w.rewritten {
+		setContentLength(w.delegate.Header(), len(w.body))
+	}
+
 	// If we deferred the response, release it.
 	if statusCode := w.statusCode; statusCode != 0 {
 		w.delegate.WriteHeader(int(statusCode))
@@ -60,3 +129,67 @@ func (w *bufferingResponseWriter) release() {
 		w.delegate.Write(body) // nolint
 	}
 }
+
+// headersHookResponseWriter calls hook before the status code and headers
+// are sent, then streams the response body to the delegate.
+type headersHookResponseWriter struct {
+	delegate   http.ResponseWriter
+	statusCode uint32
+	hook       func() error
+	hooked     bool
+	err        error
+}
+
+// Header dispatches to the delegate.
+func (w *headersHookResponseWriter) Header() http.Header {
+	return w.delegate.Header()
+}
+
+// Write ensures the hook was called, then dispatches to the delegate.
+func (w *headersHookResponseWriter) Write(bytes []byte) (int, error) {
+	if !w.hooked {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	return w.delegate.Write(bytes)
+}
+
+// WriteHeader calls the hook, which may change the status code, then
+// dispatches to the delegate. Informational (1xx) status codes are
+// dispatched without calling the hook.
+func (w *headersHookResponseWriter) WriteHeader(statusCode int) {
+	if statusCode < 200 {
+		w.delegate.WriteHeader(statusCode)
+		return
+	} else if w.hooked {
+		return // superfluous
+	}
+	w.hooked = true
+	w.statusCode = uint32(statusCode)
+	if w.err = w.hook(); w.err != nil {
+		w.statusCode = http.StatusInternalServerError
+	}
+	w.delegate.WriteHeader(int(w.statusCode))
+}
+
+// Flush ensures the hook was called, then dispatches to the delegate, if it
+// is a http.Flusher.
+func (w *headersHookResponseWriter) Flush() {
+	if !w.hooked {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.delegate.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// setContentLength updates any "Content-Length" header to the given length and
+// removes any "Transfer-Encoding" header, as the body is no longer chunked.
+func setContentLength(header http.Header, length int) {
+	if _, ok := header["Content-Length"]; ok {
+		header.Set("Content-Length", strconv.Itoa(length))
+	}
+	header.Del("Transfer-Encoding")
+}
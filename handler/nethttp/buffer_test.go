@@ -3,10 +3,16 @@ package wasm
 import (
 	"io"
 	"net/http"
+
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
 )
 
-// compile-time check to ensure bufferingRequestBody implements io.ReadCloser.
-var _ io.ReadCloser = &bufferingRequestBody{}
+// compile-time check to ensure bufferingRequestBody implements io.ReadCloser
+// and handler.BodyPeeker.
+var (
+	_ io.ReadCloser      = &bufferingRequestBody{}
+	_ handler.BodyPeeker = &bufferingRequestBody{}
+)
 
 // compile-time check to ensure bufferingResponseWriter implements
 // http.ResponseWriter.
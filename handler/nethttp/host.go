@@ -3,6 +3,8 @@ package wasm
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/textproto"
@@ -15,15 +17,26 @@ import (
 
 type host struct{}
 
-var _ handler.Host = host{}
+var (
+	_ handler.Host          = host{}
+	_ handler.HeadersHost   = host{}
+	_ handler.AuthorityHost = host{}
+
+	_ handler.QueryCookiesHost  = host{}
+	_ handler.InformationalHost = host{}
+)
 
 // EnableFeatures implements the same method as documented on handler.Host.
 func (host) EnableFeatures(ctx context.Context, features handler.Features) handler.Features {
+	// net/http canonicalizes header names and stores them in a map, so it
+	// can't support raw headers.
+	features &^= handler.FeatureRawHeaders
+
 	if s, ok := ctx.Value(requestStateKey{}).(*requestState); ok {
 		s.enableFeatures(features)
 	}
 	// Otherwise, this was called during init, but there's nothing to do
-	// because net/http supports all features.
+	// because net/http supports all other features.
 	return features
 }
 
@@ -66,7 +79,17 @@ func (host) SetURI(ctx context.Context, uri string) {
 	}
 	u, err := url.ParseRequestURI(uri)
 	if err != nil {
-		panic(err)
+		panic(fmt.Errorf("invalid uri %q: %w", uri, err))
+	}
+	if u.Opaque != "" || u.User != nil {
+		panic(fmt.Errorf("invalid uri %q: must be origin-form or absolute-form", uri))
+	}
+	if u.Scheme != "" { // absolute-form
+		scheme := mustValidScheme(u.Scheme)
+		authority := mustValidAuthority(u.Host)
+		r.URL.Scheme = scheme
+		r.URL.Host = authority
+		r.Host = authority
 	}
 	r.RequestURI = uri
 	r.URL.RawPath = u.RawPath
@@ -75,6 +98,72 @@ func (host) SetURI(ctx context.Context, uri string) {
 	r.URL.RawQuery = u.RawQuery
 }
 
+// GetAuthority implements the same method as documented on
+// handler.AuthorityHost.
+func (host) GetAuthority(ctx context.Context) string {
+	r := requestStateFromContext(ctx).r
+	if r.Host != "" {
+		return r.Host
+	}
+	return r.URL.Host
+}
+
+// SetAuthority implements the same method as documented on
+// handler.AuthorityHost.
+func (host) SetAuthority(ctx context.Context, authority string) {
+	r := requestStateFromContext(ctx).r
+	authority = mustValidAuthority(authority)
+	r.Host = authority
+	if r.URL.Host != "" { // keep absolute-form consistent
+		r.URL.Host = authority
+	}
+}
+
+// GetScheme implements the same method as documented on
+// handler.AuthorityHost.
+func (host) GetScheme(ctx context.Context) string {
+	r := requestStateFromContext(ctx).r
+	if r.URL.Scheme != "" {
+		return r.URL.Scheme
+	} else if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// SetScheme implements the same method as documented on
+// handler.AuthorityHost.
+func (host) SetScheme(ctx context.Context, scheme string) {
+	r := requestStateFromContext(ctx).r
+	r.URL.Scheme = mustValidScheme(scheme)
+	if r.URL.Host == "" { // a scheme without a host isn't a valid URL.
+		r.URL.Host = r.Host
+	}
+}
+
+// mustValidScheme returns the lowercase scheme or panics if it isn't http or
+// https.
+func mustValidScheme(scheme string) string {
+	switch s := strings.ToLower(scheme); s {
+	case "http", "https":
+		return s
+	default:
+		panic(fmt.Errorf("invalid scheme %q: must be http or https", scheme))
+	}
+}
+
+// mustValidAuthority returns the authority or panics if it is empty or
+// includes anything besides a host and optional port.
+func mustValidAuthority(authority string) string {
+	if authority == "" {
+		panic(errors.New("invalid authority: empty"))
+	}
+	if u, err := url.Parse("//" + authority); err != nil || u.Host != authority || u.User != nil {
+		panic(fmt.Errorf("invalid authority %q: must be a host and optional port", authority))
+	}
+	return authority
+}
+
 // GetProtocolVersion implements the same method as documented on handler.Host.
 func (host) GetProtocolVersion(ctx context.Context) string {
 	r := requestStateFromContext(ctx).r
@@ -119,41 +208,110 @@ func (host) GetRequestHeaderNames(ctx context.Context) (names []string) {
 func (host) GetRequestHeaderValues(ctx context.Context, name string) []string {
 	r := requestStateFromContext(ctx).r
 	if textproto.CanonicalMIMEHeaderKey(name) == "Host" { // special-case the host header.
+		if r.Host == "" {
+			return nil
+		}
 		return []string{r.Host}
 	}
 	return r.Header.Values(name)
 }
 
 // SetRequestHeaderValue implements the same method as documented on handler.Host.
-func (host) SetRequestHeaderValue(ctx context.Context, name, value string) {
+func (h host) SetRequestHeaderValue(ctx context.Context, name, value string) {
 	s := requestStateFromContext(ctx)
+	if textproto.CanonicalMIMEHeaderKey(name) == "Host" { // special-case the host header.
+		h.SetAuthority(ctx, value)
+		return
+	}
 	s.r.Header.Set(name, value)
 }
 
 // AddRequestHeaderValue implements the same method as documented on handler.Host.
-func (host) AddRequestHeaderValue(ctx context.Context, name, value string) {
+func (h host) AddRequestHeaderValue(ctx context.Context, name, value string) {
 	s := requestStateFromContext(ctx)
+	if textproto.CanonicalMIMEHeaderKey(name) == "Host" { // special-case the host header.
+		if s.r.Host != "" {
+			panic(errors.New("can't add a value to the host header: it can only have one"))
+		}
+		h.SetAuthority(ctx, value)
+		return
+	}
 	s.r.Header.Add(name, value)
 }
 
 // RemoveRequestHeader implements the same method as documented on handler.Host.
 func (host) RemoveRequestHeader(ctx context.Context, name string) {
 	s := requestStateFromContext(ctx)
+	if textproto.CanonicalMIMEHeaderKey(name) == "Host" { // special-case the host header.
+		s.r.Host = ""
+		return
+	}
 	s.r.Header.Del(name)
 }
 
+// GetQueryValues implements the same method as documented on
+// handler.QueryCookiesHost.
+func (host) GetQueryValues(ctx context.Context, name string) []string {
+	r := requestStateFromContext(ctx).r
+	return r.URL.Query()[name]
+}
+
+// SetQueryValue implements the same method as documented on
+// handler.QueryCookiesHost.
+func (host) SetQueryValue(ctx context.Context, name, value string) {
+	r := requestStateFromContext(ctx).r
+	setRawQuery(r, editQuery(r.URL.RawQuery, name, &value))
+}
+
+// RemoveQuery implements the same method as documented on
+// handler.QueryCookiesHost.
+func (host) RemoveQuery(ctx context.Context, name string) {
+	r := requestStateFromContext(ctx).r
+	setRawQuery(r, editQuery(r.URL.RawQuery, name, nil))
+}
+
+// GetCookieValues implements the same method as documented on
+// handler.QueryCookiesHost.
+func (host) GetCookieValues(ctx context.Context, name string) (values []string) {
+	r := requestStateFromContext(ctx).r
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			values = append(values, c.Value)
+		}
+	}
+	return
+}
+
+// SetCookieValue implements the same method as documented on
+// handler.QueryCookiesHost.
+func (host) SetCookieValue(ctx context.Context, name, value string) {
+	r := requestStateFromContext(ctx).r
+	if err := (&http.Cookie{Name: name, Value: value}).Valid(); err != nil {
+		panic(fmt.Errorf("invalid cookie %q: %w", name, err))
+	}
+	editCookies(r, name, &value)
+}
+
+// RemoveCookie implements the same method as documented on
+// handler.QueryCookiesHost.
+func (host) RemoveCookie(ctx context.Context, name string) {
+	r := requestStateFromContext(ctx).r
+	editCookies(r, name, nil)
+}
+
 // RequestBodyReader implements the same method as documented on handler.Host.
 func (host) RequestBodyReader(ctx context.Context) io.ReadCloser {
 	s := requestStateFromContext(ctx)
-	return s.r.Body
+	return s.requestBodyReader()
 }
 
 // RequestBodyWriter implements the same method as documented on handler.Host.
 func (host) RequestBodyWriter(ctx context.Context) io.Writer {
 	s := requestStateFromContext(ctx)
-	var b bytes.Buffer // reset
-	s.r.Body = io.NopCloser(&b)
-	return &b
+	b := &bytes.Buffer{} // reset
+	s.r.Body = io.NopCloser(b)
+	s.requestBody = b
+	return b
 }
 
 // GetRequestTrailerNames implements the same method as documented on
@@ -193,23 +351,38 @@ func (host) RemoveRequestTrailer(ctx context.Context, name string) {
 // GetStatusCode implements the same method as documented on handler.Host.
 func (host) GetStatusCode(ctx context.Context) uint32 {
 	s := requestStateFromContext(ctx)
-	if statusCode := s.w.(*bufferingResponseWriter).statusCode; statusCode == 0 {
-		return 200 // default
+	var statusCode uint32
+	if w, ok := s.w.(*headersHookResponseWriter); ok {
+		statusCode = w.statusCode
 	} else {
-		return statusCode
+		statusCode = s.w.(*bufferingResponseWriter).statusCode
 	}
+	if statusCode == 0 {
+		return 200 // default
+	}
+	return statusCode
 }
 
 // SetStatusCode implements the same method as documented on handler.Host.
 func (host) SetStatusCode(ctx context.Context, statusCode uint32) {
 	s := requestStateFromContext(ctx)
-	if w, ok := s.w.(*bufferingResponseWriter); ok {
+	switch w := s.w.(type) {
+	case *bufferingResponseWriter:
 		w.statusCode = statusCode
-	} else {
+	case *headersHookResponseWriter: // in handler.FuncHandleResponseHeaders
+		w.statusCode = statusCode
+	default:
 		s.w.WriteHeader(int(statusCode))
 	}
 }
 
+// SendInformational implements the same method as documented on
+// handler.InformationalHost.
+func (host) SendInformational(ctx context.Context, statusCode uint32) {
+	s := requestStateFromContext(ctx)
+	s.w.WriteHeader(int(statusCode))
+}
+
 // GetResponseHeaderNames implements the same method as documented on
 // handler.Host.
 func (host) GetResponseHeaderNames(ctx context.Context) (names []string) {
@@ -278,6 +451,7 @@ func (host) ResponseBodyWriter(ctx context.Context) io.Writer {
 	s := requestStateFromContext(ctx)
 	if w, ok := s.w.(*bufferingResponseWriter); ok {
 		w.body = nil // reset
+		w.rewritten = true
 		return w
 	} else {
 		return s.w
@@ -318,6 +492,39 @@ func (host) RemoveResponseTrailer(ctx context.Context, name string) {
 	removeTrailer(header, name)
 }
 
+// GetHeaders implements the same method as documented on
+// handler.HeadersHost.
+func (h host) GetHeaders(ctx context.Context, kind handler.HeaderKind) (fields []string) {
+	s := requestStateFromContext(ctx)
+	switch kind {
+	case handler.HeaderKindRequest:
+		for _, n := range h.GetRequestHeaderNames(ctx) {
+			if n == "Host" { // special-case the host header.
+				fields = append(fields, n, s.r.Host)
+				continue
+			}
+			for _, v := range s.r.Header[n] {
+				fields = append(fields, n, v)
+			}
+		}
+	case handler.HeaderKindResponse:
+		header := s.w.Header()
+		for _, n := range h.GetResponseHeaderNames(ctx) {
+			for _, v := range header[n] {
+				fields = append(fields, n, v)
+			}
+		}
+	case handler.HeaderKindRequestTrailers, handler.HeaderKindResponseTrailers:
+		header := s.w.Header()
+		for _, n := range trailerNames(header) {
+			for _, v := range header[http.TrailerPrefix+n] {
+				fields = append(fields, n, v)
+			}
+		}
+	}
+	return
+}
+
 func trailerNames(header http.Header) (names []string) {
 	// We don't pre-allocate as there may be no trailers.
 	for n := range header {
@@ -352,3 +559,84 @@ func (host) GetSourceAddr(ctx context.Context) string {
 	r := requestStateFromContext(ctx).r
 	return r.RemoteAddr
 }
+
+// editQuery returns the raw query with all values of the name replaced by
+// the value, or removed if the value is nil. The order of other parameters
+// is preserved, and a new parameter is appended.
+func editQuery(rawQuery, name string, value *string) string {
+	var b strings.Builder
+	replaced := false
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		key, _, _ := strings.Cut(pair, "=")
+		if k, err := url.QueryUnescape(key); err == nil && k == name {
+			if value == nil || replaced {
+				continue
+			}
+			pair = url.QueryEscape(name) + "=" + url.QueryEscape(*value)
+			replaced = true
+		}
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(pair)
+	}
+	if value != nil && !replaced {
+		if b.Len() > 0 {
+			b.WriteByte('&')
+		}
+		b.WriteString(url.QueryEscape(name) + "=" + url.QueryEscape(*value))
+	}
+	return b.String()
+}
+
+// setRawQuery overwrites the query of the request URL and RequestURI.
+func setRawQuery(r *http.Request, rawQuery string) {
+	r.URL.RawQuery = rawQuery
+	r.URL.ForceQuery = false
+	requestURI := r.RequestURI
+	if i := strings.IndexByte(requestURI, '?'); i != -1 {
+		requestURI = requestURI[:i]
+	}
+	if rawQuery != "" {
+		requestURI += "?" + rawQuery
+	}
+	r.RequestURI = requestURI
+}
+
+// editCookies rewrites the "Cookie" request header with all values of the
+// name replaced by the value, or removed if the value is nil. The order of
+// other cookies is preserved, and a new cookie is appended.
+//
+// Note: Multiple "Cookie" headers are merged into one, and cookies
+// http.Request Cookies can't parse are dropped.
+func editCookies(r *http.Request, name string, value *string) {
+	var b strings.Builder
+	replaced := false
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			if value == nil || replaced {
+				continue
+			}
+			c.Value = *value
+			replaced = true
+		}
+		if b.Len() > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString(c.String())
+	}
+	if value != nil && !replaced {
+		if b.Len() > 0 {
+			b.WriteString("; ")
+		}
+		b.WriteString((&http.Cookie{Name: name, Value: *value}).String())
+	}
+	if b.Len() == 0 {
+		r.Header.Del("Cookie")
+	} else {
+		r.Header.Set("Cookie", b.String())
+	}
+}
@@ -3,6 +3,7 @@ package wasm
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -15,11 +16,11 @@ var testCtx = context.Background()
 
 func Test_host(t *testing.T) {
 	newCtx := func(features handler.Features) (context.Context, handler.Features) {
-		// The below configuration supports all features.
+		// The below configuration supports all features except raw headers.
 		r, _ := http.NewRequest("GET", "", bytes.NewReader(nil))
 		r.RemoteAddr = "1.2.3.4:12345"
 		w := &bufferingResponseWriter{delegate: &httptest.ResponseRecorder{HeaderMap: map[string][]string{}}}
-		return context.WithValue(testCtx, requestStateKey{}, &requestState{r: r, w: w}), features
+		return context.WithValue(testCtx, requestStateKey{}, &requestState{r: r, w: w}), features &^ handler.FeatureRawHeaders
 	}
 
 	if err := handlertest.HostTest(t, host{}, newCtx); err != nil {
@@ -44,3 +45,116 @@ func Test_host_GetProtocolVersion(t *testing.T) {
 		})
 	}
 }
+
+// Test_host_SetURI_Invalid ensures unsupported URIs trap with a clear error.
+func Test_host_SetURI_Invalid(t *testing.T) {
+	tests := []struct {
+		uri, expected string
+	}{
+		{uri: "example.com:443", expected: `invalid uri "example.com:443": must be origin-form or absolute-form`},
+		{uri: "https://user@example.com/", expected: `invalid uri "https://user@example.com/": must be origin-form or absolute-form`},
+		{uri: "ftp://example.com/", expected: `invalid scheme "ftp": must be http or https`},
+		{uri: "https:///foo", expected: `invalid authority: empty`},
+		{uri: "a b", expected: `invalid uri "a b": parse "a b": invalid URI for request`},
+	}
+
+	h := host{}
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.uri, func(t *testing.T) {
+			r, _ := http.NewRequest("GET", "", nil)
+			ctx := context.WithValue(testCtx, requestStateKey{}, &requestState{r: r})
+
+			requirePanic(t, tc.expected, func() { h.SetURI(ctx, tc.uri) })
+		})
+	}
+}
+
+// Test_host_Host ensures the "Host" request header is consistent with the
+// authority of the request.
+func Test_host_Host(t *testing.T) {
+	h := host{}
+	r, _ := http.NewRequest("GET", "http://localhost/", nil)
+	ctx := context.WithValue(testCtx, requestStateKey{}, &requestState{r: r})
+
+	h.SetRequestHeaderValue(ctx, "Host", "example.com")
+	if want, have := "example.com", r.Host; want != have {
+		t.Errorf("unexpected host, want: %v, have: %v", want, have)
+	}
+	if want, have := "example.com", r.URL.Host; want != have {
+		t.Errorf("unexpected URL host, want: %v, have: %v", want, have)
+	}
+	if _, ok := r.Header["Host"]; ok {
+		t.Error("expected the host to not be in the header map")
+	}
+
+	requirePanic(t, "can't add a value to the host header: it can only have one", func() {
+		h.AddRequestHeaderValue(ctx, "Host", "example.org")
+	})
+
+	h.RemoveRequestHeader(ctx, "Host")
+	if have := h.GetRequestHeaderValues(ctx, "Host"); have != nil {
+		t.Errorf("unexpected host values, want: nil, have: %v", have)
+	}
+
+	h.AddRequestHeaderValue(ctx, "Host", "example.org")
+	if want, have := "example.org", r.Host; want != have {
+		t.Errorf("unexpected host, want: %v, have: %v", want, have)
+	}
+
+	requirePanic(t, `invalid authority "example.org/path": must be a host and optional port`, func() {
+		h.SetAuthority(ctx, "example.org/path")
+	})
+}
+
+func requirePanic(t *testing.T, expected string, fn func()) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		if recovered := recover(); recovered == nil {
+			t.Error("expected a panic")
+		} else if want, have := expected, fmt.Sprint(recovered); want != have {
+			t.Errorf("unexpected panic, want: %v, have: %v", want, have)
+		}
+	}()
+	fn()
+}
+
+// Test_host_QueryCookies ensures editing one query parameter or cookie
+// preserves the order of others.
+func Test_host_QueryCookies(t *testing.T) {
+	h := host{}
+	r, _ := http.NewRequest("GET", "/a?x=1&tag=a&y=2&tag=b", nil)
+	r.RequestURI = "/a?x=1&tag=a&y=2&tag=b"
+	r.Header.Set("Cookie", "a=b; c=d; e=f")
+	ctx := context.WithValue(testCtx, requestStateKey{}, &requestState{r: r})
+
+	h.SetQueryValue(ctx, "tag", "c d")
+	if want, have := "/a?x=1&tag=c+d&y=2", r.RequestURI; want != have {
+		t.Errorf("unexpected RequestURI, want: %v, have: %v", want, have)
+	}
+
+	h.SetQueryValue(ctx, "z", "3")
+	h.RemoveQuery(ctx, "x")
+	if want, have := "/a?tag=c+d&y=2&z=3", h.GetURI(ctx); want != have {
+		t.Errorf("unexpected URI, want: %v, have: %v", want, have)
+	}
+
+	h.SetCookieValue(ctx, "c", "g")
+	h.SetCookieValue(ctx, "h", "i")
+	h.RemoveCookie(ctx, "a")
+	if want, have := "c=g; e=f; h=i", r.Header.Get("Cookie"); want != have {
+		t.Errorf("unexpected Cookie header, want: %v, have: %v", want, have)
+	}
+
+	requirePanic(t, `invalid cookie "a b": http: invalid Cookie.Name`, func() {
+		h.SetCookieValue(ctx, "a b", "c")
+	})
+
+	h.RemoveCookie(ctx, "c")
+	h.RemoveCookie(ctx, "e")
+	h.RemoveCookie(ctx, "h")
+	if _, ok := r.Header["Cookie"]; ok {
+		t.Error("expected the Cookie header to be removed")
+	}
+}
@@ -1,9 +1,8 @@
 package wasm
 
 import (
+	"bytes"
 	"context"
-	"fmt"
-	"io"
 	"net/http"
 
 	handlerapi "github.com/http-wasm/http-wasm-host-go/api/handler"
@@ -37,6 +36,9 @@ type requestState struct {
 	r        *http.Request
 	next     http.Handler
 	features handlerapi.Features
+
+	// requestBody is non-nil when the guest rewrote the request body.
+	requestBody *bytes.Buffer
 }
 
 func newRequestState(w http.ResponseWriter, r *http.Request, g *guest) *requestState {
@@ -48,7 +50,7 @@ func newRequestState(w http.ResponseWriter, r *http.Request, g *guest) *requestS
 func (s *requestState) enableFeatures(features handlerapi.Features) {
 	s.features = s.features.WithEnabled(features)
 	if features.IsEnabled(handlerapi.FeatureBufferRequest) {
-		s.r.Body = &bufferingRequestBody{delegate: s.r.Body}
+		s.requestBodyReader().retain = true
 	}
 	if s.features.IsEnabled(handlerapi.FeatureBufferResponse) {
 		if _, ok := s.w.(*bufferingResponseWriter); !ok { // don't double-wrap
@@ -57,26 +59,35 @@ func (s *requestState) enableFeatures(features handlerapi.Features) {
 	}
 }
 
+// requestBodyReader returns the request body read by the guest, lazy
+// wrapping the current one. This doesn't read the body, as doing so makes
+// the server send "100 Continue" to clients that expect it.
+func (s *requestState) requestBodyReader() *bufferingRequestBody {
+	br, ok := s.r.Body.(*bufferingRequestBody)
+	if !ok {
+		br = &bufferingRequestBody{delegate: s.r.Body}
+		s.r.Body = br
+	}
+	return br
+}
+
 func (s *requestState) handleNext() (err error) {
 	defer func() {
 		if recovered := recover(); recovered != nil {
-			if e, ok := recovered.(error); ok {
-				err = e
-			} else {
-				err = fmt.Errorf("%v", recovered)
-			}
+			err = &handlerapi.PanicError{Value: recovered}
 		}
 	}()
 
 	// If we set the intercepted the request body for any reason, reset it
 	// before calling downstream.
 	if br, ok := s.r.Body.(*bufferingRequestBody); ok {
-		if br.buffer.Len() == 0 {
-			s.r.Body = br.delegate
-		} else {
-			br.Close() // nolint
-			s.r.Body = io.NopCloser(&br.buffer)
-		}
+		s.r.Body = br.nextBody()
+	}
+	// If the guest rewrote the request body, its length is likely different.
+	if b := s.requestBody; b != nil {
+		setContentLength(s.r.Header, b.Len())
+		s.r.ContentLength = int64(b.Len())
+		s.r.TransferEncoding = nil
 	}
 	s.next.ServeHTTP(s.w, s.r)
 	return
@@ -89,10 +100,11 @@ func requestStateFromContext(ctx context.Context) *requestState {
 // NewHandler implements the same method as documented on handler.Middleware.
 func (w *middleware) NewHandler(_ context.Context, next http.Handler) http.Handler {
 	return &guest{
-		handleRequest:  w.m.HandleRequest,
-		handleResponse: w.m.HandleResponse,
-		next:           next,
-		features:       w.m.Features(),
+		handleRequest:         w.m.HandleRequest,
+		handleResponse:        w.m.HandleResponse,
+		handleResponseHeaders: w.m.HandleResponseHeaders,
+		next:                  next,
+		features:              w.m.Features(),
 	}
 }
 
@@ -102,10 +114,11 @@ func (w *middleware) Close(ctx context.Context) error {
 }
 
 type guest struct {
-	handleRequest  func(ctx context.Context) (outCtx context.Context, ctxNext handlerapi.CtxNext, err error)
-	handleResponse func(ctx context.Context, reqCtx uint32, err error) error
-	next           http.Handler
-	features       handlerapi.Features
+	handleRequest         func(ctx context.Context) (outCtx context.Context, ctxNext handlerapi.CtxNext, err error)
+	handleResponse        func(ctx context.Context, reqCtx uint32, err error) error
+	handleResponseHeaders func(ctx context.Context, reqCtx uint32) error
+	next                  http.Handler
+	features              handlerapi.Features
 }
 
 // ServeHTTP implements http.Handler
@@ -130,11 +143,36 @@ func (g *guest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// If enabled, intercept the response headers from the next handler,
+	// without buffering the response body.
+	var hw *headersHookResponseWriter
+	if s.features.IsEnabled(handlerapi.FeatureResponseHeaders) &&
+		!s.features.IsEnabled(handlerapi.FeatureBufferResponse) {
+		hw = &headersHookResponseWriter{delegate: s.w, hook: func() error {
+			return g.handleResponseHeaders(outCtx, uint32(ctxNext>>32))
+		}}
+		s.w = hw
+	}
+
 	// Otherwise, the host calls the next handler.
 	err := s.handleNext()
 
+	// Ensure the guest sees the response headers, even if the next handler
+	// didn't write any response.
+	if hw != nil && err == nil {
+		if !hw.hooked {
+			hw.WriteHeader(http.StatusOK)
+		}
+		err = hw.err
+	}
+
 	// Finally, call the guest with the response or error
 	if err = g.handleResponse(outCtx, uint32(ctxNext>>32), err); err != nil {
+		// The guest was aborted because the client disconnected or the request
+		// timed out, so there's no one left to respond to.
+		if r.Context().Err() != nil {
+			return
+		}
 		panic(err)
 	}
 }
@@ -1,13 +1,24 @@
 package wasm_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 
 	handlerapi "github.com/http-wasm/http-wasm-host-go/api/handler"
 	"github.com/http-wasm/http-wasm-host-go/handler"
@@ -192,6 +203,114 @@ func TestHeaderNames(t *testing.T) {
 	}
 }
 
+// TestHeaders uses test.BinE2EHeaders which ensures count/len are correct and
+// writes the encoded request fields to the response body.
+func TestHeaders(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EHeaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, noopHandler))
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "localhost"
+	req.Header.Set("User-Agent", "test")
+	req.Header.Add("X-Values", "a")
+	req.Header.Add("X-Values", "b")
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("invalid status code: %d, status message: %s", resp.StatusCode, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "accept-encoding\x00gzip\x00host\x00localhost\x00user-agent\x00test\x00" +
+		"x-values\x00a\x00x-values\x00b\x00"
+	if have := string(body); want != have {
+		t.Fatalf("unexpected response body, want: %q, have: %q", want, have)
+	}
+}
+
+// TestRawHeaders ensures names are lowercased as net/http doesn't support
+// handler.FeatureRawHeaders.
+func TestRawHeaders(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2ERawHeaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, noopHandler))
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "localhost"
+	req.Header["User-Agent"] = []string{"test"}
+	req.Header["x-Values"] = []string{"a"}
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "accept-encoding\x00gzip\x00host\x00localhost\x00user-agent\x00test\x00x-values\x00a\x00"
+	if have := string(body); want != have {
+		t.Fatalf("unexpected response body, want: %q, have: %q", want, have)
+	}
+}
+
+func TestQueryCookies(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EQueryCookies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, noopHandler))
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/?tag=a&other=b&tag=c%20d", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Cookie", "session=abc; other=def")
+
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, have := "a\x00c d\x00abc\x00", string(body); want != have {
+		t.Fatalf("unexpected response body, want: %q, have: %q", want, have)
+	}
+}
+
 func TestHeaderValue(t *testing.T) {
 	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EHeaderValue)
 	if err != nil {
@@ -236,3 +355,621 @@ func TestHandleResponse(t *testing.T) {
 		t.Fatalf("invalid status code: %d, status message: %s", resp.StatusCode, resp.Status)
 	}
 }
+
+// TestHandleResponse_Canceled ensures a request canceled while the guest
+// handles the response doesn't panic.
+func TestHandleResponse_Canceled(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinErrorLoopOnHandleResponse)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	ctx, cancel := context.WithCancel(testCtx)
+	defer cancel()
+
+	// The client disconnects once the next handler responds, so the guest is
+	// aborted while looping in handle_response.
+	next := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		cancel()
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	mw.NewHandler(testCtx, next).ServeHTTP(httptest.NewRecorder(), req)
+}
+
+// TestResponseHeaders ensures the guest can change the status and headers of
+// the next handler without buffering its response body.
+func TestResponseHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		next http.Handler
+		body string
+	}{
+		{
+			name: "streaming",
+			next: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.Write([]byte("hello ")) // nolint
+				w.(http.Flusher).Flush()
+				w.Write([]byte("world")) // nolint
+			}),
+			body: "hello world",
+		},
+		{
+			name: "no response",
+			next: noopHandler,
+		},
+	}
+
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EResponseHeaders)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			ts := httptest.NewServer(mw.NewHandler(testCtx, tc.next))
+			defer ts.Close()
+
+			resp, err := ts.Client().Get(ts.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if want, have := http.StatusCreated, resp.StatusCode; want != have {
+				t.Fatalf("unexpected status code, want: %d, have: %d", want, have)
+			}
+			if want, have := "1", resp.Header.Get("x-hook"); want != have {
+				t.Fatalf("unexpected x-hook, want: %q, have: %q", want, have)
+			}
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := tc.body, string(body); want != have {
+				t.Fatalf("unexpected response body, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
+
+// TestDecodeContent ensures test.BinExampleRedact can redact encoded bodies,
+// which it can't when the host doesn't decode them.
+func TestDecodeContent(t *testing.T) {
+	secret := "open sesame"
+	// Repeat text so that it compresses, as gzip otherwise stores it as-is.
+	hello := strings.Repeat("hello ", 100)
+	body := hello + secret
+	redacted := hello + "###########"
+
+	tests := []struct {
+		name                       string
+		encoding                   string
+		options                    []handler.Option
+		expectedEncoding, expected string
+	}{
+		{
+			name:             "default",
+			encoding:         "gzip",
+			expectedEncoding: "gzip",
+			expected:         body,
+		},
+		{
+			name:             "reencode",
+			encoding:         "gzip",
+			options:          []handler.Option{handler.DecodeContent(handler.ContentEncodingReencode)},
+			expectedEncoding: "gzip",
+			expected:         redacted,
+		},
+		{
+			name:     "drop",
+			encoding: "gzip",
+			options:  []handler.Option{handler.DecodeContent(handler.ContentEncodingDrop)},
+			expected: redacted,
+		},
+		{
+			name:             "reencode br",
+			encoding:         "br",
+			options:          []handler.Option{handler.DecodeContent(handler.ContentEncodingReencode)},
+			expectedEncoding: "br",
+			expected:         redacted,
+		},
+		{
+			name:     "drop br",
+			encoding: "br",
+			options:  []handler.Option{handler.DecodeContent(handler.ContentEncodingDrop)},
+			expected: redacted,
+		},
+		{
+			name:             "reencode zstd",
+			encoding:         "zstd",
+			options:          []handler.Option{handler.DecodeContent(handler.ContentEncodingReencode)},
+			expectedEncoding: "zstd",
+			expected:         redacted,
+		},
+		{
+			name:     "drop zstd",
+			encoding: "zstd",
+			options:  []handler.Option{handler.DecodeContent(handler.ContentEncodingDrop)},
+			expected: redacted,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			options := append([]handler.Option{handler.GuestConfig([]byte(secret))}, tc.options...)
+			mw, err := wasm.NewMiddleware(testCtx, test.BinExampleRedact, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			var requestEncoding, requestBody string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requestEncoding = r.Header.Get("Content-Encoding")
+				requestBody = decodeBody(t, requestEncoding, r.Body)
+
+				w.Header().Set("Content-Encoding", tc.encoding)
+				w.Write(encodeBody(t, tc.encoding, body)) // nolint
+			})
+
+			ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodPost, ts.URL, bytes.NewReader(encodeBody(t, tc.encoding, body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Encoding", tc.encoding)
+			// Set explicitly, so that the client doesn't decode the response.
+			req.Header.Set("Accept-Encoding", tc.encoding)
+
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if want, have := tc.expectedEncoding, requestEncoding; want != have {
+				t.Errorf("unexpected request encoding, want: %q, have: %q", want, have)
+			}
+			if want, have := tc.expected, requestBody; want != have {
+				t.Errorf("unexpected request body, want: %q, have: %q", want, have)
+			}
+
+			responseEncoding := resp.Header.Get("Content-Encoding")
+			if want, have := tc.expectedEncoding, responseEncoding; want != have {
+				t.Errorf("unexpected response encoding, want: %q, have: %q", want, have)
+			}
+			if want, have := tc.expected, decodeBody(t, responseEncoding, resp.Body); want != have {
+				t.Errorf("unexpected response body, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
+
+// TestWriteBody ensures framing and ETag headers are consistent with bodies
+// rewritten by the guest.
+func TestWriteBody(t *testing.T) {
+	// sha256("hello") truncated to 16 bytes
+	helloETag := `"2cf24dba5fb0a30e26e83b2ac5b9e29e"`
+
+	tests := []struct {
+		name         string
+		options      []handler.Option
+		etag         string
+		expectedETag string
+	}{
+		{
+			name:         "default",
+			etag:         `"next"`,
+			expectedETag: `"next"`,
+		},
+		{
+			name:    "drop",
+			options: []handler.Option{handler.RewriteETag(handler.ETagDrop)},
+			etag:    `"next"`,
+		},
+		{
+			name:         "drop weak",
+			options:      []handler.Option{handler.RewriteETag(handler.ETagDrop)},
+			etag:         `W/"next"`,
+			expectedETag: `W/"next"`,
+		},
+		{
+			name:         "recompute",
+			options:      []handler.Option{handler.RewriteETag(handler.ETagRecompute)},
+			etag:         `"next"`,
+			expectedETag: helloETag,
+		},
+		{
+			name:    "recompute missing",
+			options: []handler.Option{handler.RewriteETag(handler.ETagRecompute)},
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			mw, err := wasm.NewMiddleware(testCtx, test.BinE2EWriteBody, tc.options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			var contentLength int64
+			var contentLengthHeader, requestBody string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentLength = r.ContentLength
+				contentLengthHeader = r.Header.Get("Content-Length")
+				body, _ := io.ReadAll(r.Body)
+				requestBody = string(body)
+
+				if tc.etag != "" {
+					w.Header().Set("ETag", tc.etag)
+				}
+				w.Header().Set("Content-Length", "100")
+				w.Write([]byte(strings.Repeat("a", 100))) // nolint
+			})
+
+			ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+			defer ts.Close()
+
+			resp, err := ts.Client().Post(ts.URL, "text/plain", strings.NewReader(strings.Repeat("a", 100)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if want, have := int64(5), contentLength; want != have {
+				t.Errorf("unexpected request content length, want: %d, have: %d", want, have)
+			}
+			if contentLengthHeader != "" && contentLengthHeader != "5" {
+				t.Errorf("unexpected request Content-Length: %s", contentLengthHeader)
+			}
+			if want, have := "hello", requestBody; want != have {
+				t.Errorf("unexpected request body, want: %q, have: %q", want, have)
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := "hello", string(body); want != have {
+				t.Errorf("unexpected response body, want: %q, have: %q", want, have)
+			}
+			if want, have := int64(5), resp.ContentLength; want != have {
+				t.Errorf("unexpected response content length, want: %d, have: %d", want, have)
+			}
+			if want, have := tc.expectedETag, resp.Header.Get("ETag"); want != have {
+				t.Errorf("unexpected ETag, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
+
+// TestPeekBody ensures the next handler reads the whole request body after
+// the guest peeked it, even though handler.FeatureBufferRequest is disabled.
+func TestPeekBody(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EPeekBody)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	var peeked, requestBody string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peeked = r.Header.Get("x-peek")
+		body, _ := io.ReadAll(r.Body)
+		requestBody = string(body)
+	})
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+	defer ts.Close()
+
+	resp, err := ts.Client().Post(ts.URL, "text/plain", strings.NewReader("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if want, have := http.StatusOK, resp.StatusCode; want != have {
+		t.Fatalf("unexpected status code, want: %d, have: %d", want, have)
+	}
+	if want, have := "world", peeked; want != have {
+		t.Errorf("unexpected peeked, want: %q, have: %q", want, have)
+	}
+	if want, have := "hello world", requestBody; want != have {
+		t.Errorf("unexpected request body, want: %q, have: %q", want, have)
+	}
+}
+
+// TestExpectContinue ensures a guest can reject a request before reading its
+// body, without the server sending "100 Continue".
+func TestExpectContinue(t *testing.T) {
+	authorized := "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ=="
+	// expectContinueTimeout is long enough to notice if the client sent the
+	// body because the server didn't respond in time.
+	expectContinueTimeout := 10 * time.Second
+
+	tests := []struct {
+		name          string
+		guest         []byte
+		options       []handler.Option
+		authorization string
+		expectedCode  int
+		expected100   bool
+	}{
+		{
+			name:         "rejected before reading",
+			guest:        test.BinExampleAuth,
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "next reads",
+			guest:         test.BinExampleAuth,
+			authorization: authorized,
+			expectedCode:  http.StatusOK,
+			expected100:   true,
+		},
+		{
+			name:         "guest reads",
+			guest:        test.BinExampleRedact,
+			options:      []handler.Option{handler.GuestConfig([]byte("open sesame"))},
+			expectedCode: http.StatusOK,
+			expected100:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		mw, err := wasm.NewMiddleware(testCtx, tc.guest, tc.options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mw.Close(testCtx)
+
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body) // nolint
+		})
+
+		for _, http2 := range []bool{false, true} {
+			protocol := "HTTP/1.1"
+			if http2 {
+				protocol = "HTTP/2.0"
+			}
+			t.Run(fmt.Sprintf("%s/%s", tc.name, protocol), func(t *testing.T) {
+				ts := httptest.NewUnstartedServer(mw.NewHandler(testCtx, next))
+				if http2 {
+					ts.EnableHTTP2 = true
+					ts.StartTLS()
+				} else {
+					ts.Start()
+				}
+				defer ts.Close()
+
+				client := ts.Client()
+				client.Transport.(*http.Transport).ExpectContinueTimeout = expectContinueTimeout
+
+				var got100 bool
+				trace := &httptrace.ClientTrace{Got100Continue: func() { got100 = true }}
+				ctx := httptrace.WithClientTrace(testCtx, trace)
+				req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.URL, strings.NewReader("hello world"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				req.Header.Set("Expect", "100-continue")
+				if tc.authorization != "" {
+					req.Header.Set("Authorization", tc.authorization)
+				}
+
+				start := time.Now()
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer resp.Body.Close()
+
+				if want, have := tc.expectedCode, resp.StatusCode; want != have {
+					t.Errorf("unexpected status code, want: %d, have: %d", want, have)
+				}
+				if want, have := tc.expected100, got100; want != have {
+					t.Errorf("unexpected 100 Continue, want: %v, have: %v", want, have)
+				}
+				if elapsed := time.Since(start); elapsed >= expectContinueTimeout {
+					t.Errorf("server waited for the request body: %s", elapsed)
+				}
+			})
+		}
+	}
+}
+
+// TestInformational ensures a guest can send "103 Early Hints" before the
+// next handler produces the final response.
+func TestInformational(t *testing.T) {
+	link := "</style.css>; rel=preload; as=style"
+
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EInformational)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello")) // nolint
+	})
+
+	for _, http2 := range []bool{false, true} {
+		protocol := "HTTP/1.1"
+		if http2 {
+			protocol = "HTTP/2.0"
+		}
+		t.Run(protocol, func(t *testing.T) {
+			ts := httptest.NewUnstartedServer(mw.NewHandler(testCtx, next))
+			if http2 {
+				ts.EnableHTTP2 = true
+				ts.StartTLS()
+			} else {
+				ts.Start()
+			}
+			defer ts.Close()
+
+			var codes []int
+			var links []string
+			trace := &httptrace.ClientTrace{Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+				codes = append(codes, code)
+				links = append(links, header.Get("Link"))
+				return nil
+			}}
+			ctx := httptrace.WithClientTrace(testCtx, trace)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := ts.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if want, have := []int{http.StatusEarlyHints}, codes; !reflect.DeepEqual(want, have) {
+				t.Errorf("unexpected 1xx codes, want: %v, have: %v", want, have)
+			}
+			if want, have := []string{link}, links; !reflect.DeepEqual(want, have) {
+				t.Errorf("unexpected 1xx links, want: %v, have: %v", want, have)
+			}
+			if want, have := http.StatusOK, resp.StatusCode; want != have {
+				t.Errorf("unexpected status code, want: %d, have: %d", want, have)
+			}
+			if have := resp.Header.Get("Link"); have != "" {
+				t.Errorf("unexpected Link in final response: %s", have)
+			}
+		})
+	}
+}
+
+// TestHostError ensures the guest can read the error when the next handler
+// panics.
+func TestHostError(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinE2EHostError)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oops!")
+	})
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, next))
+	defer ts.Close()
+
+	resp, err := ts.Client().Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if want, have := http.StatusBadGateway, resp.StatusCode; want != have {
+		t.Errorf("unexpected status code, want: %d, have: %d", want, have)
+	}
+	if want, have := strconv.Itoa(int(handlerapi.ErrorKindPanic)), resp.Header.Get("x-error-kind"); want != have {
+		t.Errorf("unexpected error kind, want: %s, have: %s", want, have)
+	}
+	if want, have := "oops!", resp.Header.Get("x-error"); want != have {
+		t.Errorf("unexpected error, want: %s, have: %s", want, have)
+	}
+}
+
+func encodeBody(t *testing.T, encoding, body string) []byte {
+	var b bytes.Buffer
+	var w io.WriteCloser
+	switch encoding {
+	case "gzip":
+		w = gzip.NewWriter(&b)
+	case "br":
+		w = brotli.NewWriter(&b)
+	case "zstd":
+		var err error
+		if w, err = zstd.NewWriter(&b); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatalf("unsupported encoding: %s", encoding)
+	}
+	if _, err := w.Write([]byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func decodeBody(t *testing.T, encoding string, body io.Reader) string {
+	switch encoding {
+	case "gzip":
+		r, err := gzip.NewReader(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = r
+	case "br":
+		body = brotli.NewReader(body)
+	case "zstd":
+		r, err := zstd.NewReader(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		body = r
+	}
+	b, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+// TestMatch ensures requests that don't match skip the guest, using
+// test.BinExampleAuth which rejects requests without authorization.
+func TestMatch(t *testing.T) {
+	mw, err := wasm.NewMiddleware(testCtx, test.BinExampleAuth,
+		handler.Match(handler.Not(handler.PathPrefix("/public/"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+
+	ts := httptest.NewServer(mw.NewHandler(testCtx, serveJson))
+	defer ts.Close()
+
+	tests := []struct {
+		path               string
+		expectedStatusCode int
+	}{
+		{path: "/public/index.html", expectedStatusCode: http.StatusOK},
+		{path: "/private", expectedStatusCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.path, func(t *testing.T) {
+			resp, err := ts.Client().Get(ts.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if want, have := tc.expectedStatusCode, resp.StatusCode; want != have {
+				t.Errorf("unexpected status code, want: %d, have: %d", want, have)
+			}
+		})
+	}
+}
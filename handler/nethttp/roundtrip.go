@@ -0,0 +1,286 @@
+package wasm
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	handlerapi "github.com/http-wasm/http-wasm-host-go/api/handler"
+)
+
+// compile-time checks to ensure interfaces are implemented.
+var (
+	_ http.RoundTripper   = (*roundTripper)(nil)
+	_ http.Handler        = (*transport)(nil)
+	_ http.ResponseWriter = (*responseRecorder)(nil)
+)
+
+// NewRoundTripper creates an HTTP client transport implemented by the
+// WebAssembly module of mw, which sends requests with next. mw must be
+// returned by NewMiddleware. If next is nil, http.DefaultTransport is used.
+//
+// The guest handles requests and responses as it would in NewHandler,
+// including when it enables buffering. The response is what the guest would
+// have sent to a client, with an unbuffered body streamed from next. Unlike
+// NewHandler, errors from the guest are returned instead of a 500 response,
+// and informational (1xx) responses are dropped.
+func NewRoundTripper(_ context.Context, mw Middleware, next http.RoundTripper) (http.RoundTripper, error) {
+	w, ok := mw.(*middleware)
+	if !ok {
+		return nil, fmt.Errorf("wasm: %T wasn't returned by NewMiddleware", mw)
+	}
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &roundTripper{
+		handleRequest:         w.m.HandleRequest,
+		handleResponse:        w.m.HandleResponse,
+		handleResponseHeaders: w.m.HandleResponseHeaders,
+		next:                  next,
+		features:              w.m.Features(),
+	}, nil
+}
+
+type roundTripper struct {
+	handleRequest         func(ctx context.Context) (outCtx context.Context, ctxNext handlerapi.CtxNext, err error)
+	handleResponse        func(ctx context.Context, reqCtx uint32, err error) error
+	handleResponseHeaders func(ctx context.Context, reqCtx uint32) error
+	next                  http.RoundTripper
+	features              handlerapi.Features
+}
+
+// RoundTrip implements http.RoundTripper by handling the request with the
+// guest, like guest.ServeHTTP does. The response is what the guest would
+// have sent to a client.
+func (t *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A http.RoundTripper must not modify the request, but the guest can.
+	r := req.Clone(req.Context())
+
+	rec := &responseRecorder{header: http.Header{}}
+	next := &transport{next: t.next, rec: rec}
+	s := &requestState{w: rec, r: r, next: next}
+	s.enableFeatures(t.features)
+	ctx := context.WithValue(r.Context(), requestStateKey{}, s)
+	outCtx, ctxNext, err := t.handleRequest(ctx)
+	if err != nil {
+		closeRequestBody(req)
+		return nil, err
+	}
+
+	// Returning zero means the guest wants to break the handler chain, and
+	// handle the response directly.
+	if uint32(ctxNext) == 0 {
+		closeRequestBody(req)
+		if bw, ok := s.w.(*bufferingResponseWriter); ok {
+			bw.release()
+		}
+		return rec.response(req), nil
+	}
+
+	// If enabled, intercept the response headers from the next handler,
+	// without buffering the response body.
+	var hw *headersHookResponseWriter
+	if s.features.IsEnabled(handlerapi.FeatureResponseHeaders) &&
+		!s.features.IsEnabled(handlerapi.FeatureBufferResponse) {
+		hw = &headersHookResponseWriter{delegate: s.w, hook: func() error {
+			return t.handleResponseHeaders(outCtx, uint32(ctxNext>>32))
+		}}
+		s.w = hw
+	}
+
+	// Otherwise, the host sends the request.
+	err = s.handleNext()
+	if err == nil {
+		err = next.err
+	}
+
+	// Ensure the guest sees the response headers, even if there was no
+	// response.
+	if hw != nil && err == nil {
+		if !hw.hooked {
+			hw.WriteHeader(http.StatusOK)
+		}
+		err = hw.err
+	}
+
+	// Finally, call the guest with the response or error
+	if guestErr := t.handleResponse(outCtx, uint32(ctxNext>>32), err); guestErr != nil {
+		rec.closeBody()
+		return nil, guestErr
+	}
+	if err != nil {
+		rec.closeBody()
+		return nil, err
+	}
+	if bw, ok := s.w.(*bufferingResponseWriter); ok {
+		bw.release()
+	}
+	return rec.response(req), nil
+}
+
+// closeRequestBody closes the body of a request that won't be sent, as
+// required of a http.RoundTripper.
+func closeRequestBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+// transport is the next handler of a roundTripper, which sends the request
+// with the next http.RoundTripper.
+type transport struct {
+	next http.RoundTripper
+	rec  *responseRecorder
+
+	// err is the error sending the request, if any.
+	err error
+}
+
+// ServeHTTP implements http.Handler by writing the response to w. The body
+// is only copied when the guest buffers it. Otherwise, it is streamed to the
+// caller of RoundTrip.
+func (t *transport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// SetURI and friends keep RequestURI consistent, but it can't be set in
+	// client requests.
+	r.RequestURI = ""
+
+	resp, err := t.next.RoundTrip(r)
+	if err != nil {
+		t.err = err
+		return
+	}
+	t.rec.upstream = resp
+
+	header := w.Header()
+	for n, v := range resp.Header {
+		header[n] = v
+	}
+
+	bw, buffer := w.(*bufferingResponseWriter)
+	if !buffer {
+		t.rec.body = resp.Body
+		w.WriteHeader(resp.StatusCode)
+		return
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	_, err = io.Copy(bw, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.err = err
+		return
+	}
+	for n, v := range resp.Trailer {
+		header[http.TrailerPrefix+n] = v
+	}
+}
+
+// responseRecorder is the http.ResponseWriter of a roundTripper, which
+// records the response sent by the guest.
+type responseRecorder struct {
+	header     http.Header
+	statusCode int
+
+	// upstream is the response of the next http.RoundTripper, if any.
+	upstream *http.Response
+
+	// body is the unread body of the upstream response, when the guest
+	// doesn't buffer it.
+	body io.ReadCloser
+
+	// written is the body written by the guest, after any upstream body.
+	written bytes.Buffer
+}
+
+// Header implements http.ResponseWriter
+func (w *responseRecorder) Header() http.Header {
+	return w.header
+}
+
+// Write implements http.ResponseWriter
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.statusCode == 0 {
+		w.statusCode = http.StatusOK
+	}
+	return w.written.Write(p)
+}
+
+// WriteHeader implements http.ResponseWriter. Informational (1xx) status
+// codes are ignored, as there's no client to send them to.
+func (w *responseRecorder) WriteHeader(statusCode int) {
+	if statusCode < 200 || w.statusCode != 0 {
+		return
+	}
+	w.statusCode = statusCode
+}
+
+// closeBody closes any unread upstream body.
+func (w *responseRecorder) closeBody() {
+	if w.body != nil {
+		w.body.Close()
+	}
+}
+
+// response returns the recorded response to req.
+func (w *responseRecorder) response(req *http.Request) *http.Response {
+	resp := &http.Response{Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1}
+	if w.upstream != nil {
+		upstream := *w.upstream
+		resp = &upstream
+	}
+	resp.Request = req
+
+	statusCode := w.statusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	resp.StatusCode = statusCode
+	resp.Status = fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode))
+
+	resp.Header = make(http.Header, len(w.header))
+	var trailer http.Header
+	for n, v := range w.header {
+		if strings.HasPrefix(n, http.TrailerPrefix) {
+			if trailer == nil {
+				trailer = http.Header{}
+			}
+			trailer[n[len(http.TrailerPrefix):]] = v
+			continue
+		}
+		resp.Header[n] = v
+	}
+
+	switch {
+	case w.body == nil: // the guest wrote the body, if any.
+		resp.Body = io.NopCloser(&w.written)
+		resp.ContentLength = int64(w.written.Len())
+		resp.Trailer = trailer
+	case w.written.Len() == 0: // the upstream body is streamed.
+		resp.Body = w.body
+	default: // the guest wrote after the upstream body.
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(w.body, &w.written), w.body}
+		resp.ContentLength = -1
+		resp.Header.Del("Content-Length")
+	}
+	if w.body != nil {
+		// Trailers of the upstream are added to its map on EOF, so add those
+		// of the guest to the same map.
+		for n, v := range trailer {
+			if resp.Trailer == nil {
+				resp.Trailer = http.Header{}
+			}
+			resp.Trailer[n] = v
+		}
+	}
+	if resp.ContentLength >= 0 && resp.Header.Get("Content-Length") != "" {
+		resp.Header.Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	return resp
+}
@@ -2,10 +2,13 @@ package handler
 
 import (
 	"context"
+	"time"
 
 	"github.com/tetratelabs/wazero"
 
 	"github.com/http-wasm/http-wasm-host-go/api"
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
+	"github.com/http-wasm/http-wasm-host-go/verify"
 )
 
 // Option is configuration for NewMiddleware
@@ -15,7 +18,11 @@ type Option func(*options)
 // middleware instance, which also closes it.
 type NewRuntime func(context.Context) (wazero.Runtime, error)
 
-// Runtime provides the wazero.Runtime and defaults to wazero.NewRuntime.
+// Runtime provides the wazero.Runtime and defaults to DefaultRuntime.
+//
+// Note: Use wazero.RuntimeConfig WithCloseOnContextDone for guests to abort
+// when their request is canceled, like DefaultRuntime does. Otherwise, a
+// guest keeps running after the client disconnects.
 func Runtime(newRuntime NewRuntime) Option {
 	return func(h *options) {
 		h.newRuntime = newRuntime
@@ -44,14 +51,186 @@ func Logger(logger api.Logger) Option {
 	}
 }
 
+// Match adds matchers which must all match a request for the guest to handle
+// it. Requests that don't match proceed to the next handler without taking a
+// guest from the pool. By default, the guest handles all requests.
+//
+// For example, this skips the guest for health checks:
+//
+//	handler.Match(handler.Not(handler.PathPrefix("/healthz")))
+func Match(matchers ...Matcher) Option {
+	return func(h *options) {
+		h.matchers = append(h.matchers, matchers...)
+	}
+}
+
+// Metrics sets the counters recorded while handling requests. Defaults to
+// api.NoopMetrics.
+func Metrics(metrics api.Metrics) Option {
+	return func(h *options) {
+		h.metrics = metrics
+	}
+}
+
+// DecodeContent makes the guest read request and response bodies decoded,
+// when their "Content-Encoding" is "gzip", "x-gzip", "deflate", "br" or
+// "zstd". The policy controls how bodies the guest writes are encoded. By
+// default, the guest reads bodies as-is. Bodies with other encodings are also
+// read as-is, logging a warning. NewMiddleware fails if the policy is
+// unknown.
+//
+// Peeking a decoded request body requires handler.FeatureBufferRequest, even
+// if the host supports peeking without it.
+//
+// For example, this lets a guest redact gzip responses, sending them back
+// uncompressed:
+//
+//	handler.DecodeContent(handler.ContentEncodingDrop)
+func DecodeContent(policy ContentEncodingPolicy) Option {
+	return func(h *options) {
+		h.decodeContent = true
+		h.contentDecoding = policy
+	}
+}
+
+// RewriteETag sets what happens to a strong "ETag" response header when the
+// guest rewrites the response body. By default, it is left as-is.
+func RewriteETag(policy ETagPolicy) Option {
+	return func(h *options) {
+		h.etagPolicy = policy
+	}
+}
+
+// ShutdownTimeout limits how long Middleware.Close, or evicting an idle
+// guest from the pool, waits for guests that export handler.FuncShutdown.
+// Defaults to 5 seconds.
+//
+// Note: The guest is only aborted after the timeout when the runtime closes
+// modules on context done, like DefaultRuntime.
+func ShutdownTimeout(timeout time.Duration) Option {
+	return func(h *options) {
+		h.shutdownTimeout = timeout
+	}
+}
+
+// TickInterval sets how often the guest is called, when it exports
+// handler.FuncTick. Defaults to 1 second.
+func TickInterval(interval time.Duration) Option {
+	return func(h *options) {
+		h.tickInterval = interval
+	}
+}
+
+// GuestOutput logs each line the guest writes to STDOUT and STDERR, at the
+// given levels, using the Logger. Lines are prefixed with the guest's module
+// name and, during a request, any api.RequestID. By default, output is
+// written according to the ModuleConfig, which discards it.
+//
+// For example, this logs "wasi [7f3a]: POST / HTTP/1.1" for the example
+// guest "wasi.wat", if the request ID is "7f3a":
+//
+//	handler.GuestOutput(api.LogLevelInfo, api.LogLevelError)
+func GuestOutput(stdoutLevel, stderrLevel api.LogLevel) Option {
+	return func(h *options) {
+		h.logGuestOutput = true
+		h.stdoutLevel = stdoutLevel
+		h.stderrLevel = stderrLevel
+	}
+}
+
+// Sandbox limits the WASI capabilities of the guest to the policy. As a
+// ModuleConfig could grant others, NewMiddleware fails when both are set.
+// Use GuestOutput to read the STDOUT and STDERR of a sandboxed guest. By
+// default, the guest has the capabilities of the ModuleConfig.
+//
+// For example, this lets the guest read files in "/etc/myapp/data" as
+// "/data" and fails guests that import other WASI capabilities:
+//
+//	handler.Sandbox(handler.SandboxPolicy{
+//		Mounts: map[string]string{"/data": "/etc/myapp/data"},
+//		Deny:   true,
+//	})
+func Sandbox(policy SandboxPolicy) Option {
+	return func(h *options) {
+		h.sandbox = &policy
+	}
+}
+
+// AllowImports restricts the handler.HostModule functions the guest may
+// import to the policy. By default, the guest may import all of them.
+//
+// For example, this allows guests that observe requests, but fails those
+// that could change them:
+//
+//	handler.AllowImports(handler.ImportPolicy{Allowed: handler.ReadOnlyImports})
+func AllowImports(policy ImportPolicy) Option {
+	return func(h *options) {
+		h.importPolicy = &policy
+	}
+}
+
+// Verify checks the guest with the verifier before compiling it. For example,
+// this fails NewMiddleware with a *verify.SignatureError unless the guest has
+// an embedded signature by the key:
+//
+//	verifier, err := verify.Embedded(key)
+//	// handle err
+//	handler.Verify(verifier)
+func Verify(verifier verify.Verifier) Option {
+	return func(h *options) {
+		h.verifier = verifier
+	}
+}
+
+// AllowFeatures limits the features the guest can enable, such as to
+// prevent buffering of large bodies. Guests see others as unsupported, as if
+// the host didn't support them. By default, the guest can enable any feature
+// the host supports.
+func AllowFeatures(features handler.Features) Option {
+	return func(h *options) {
+		h.allowedFeatures = &features
+	}
+}
+
+// Record records the calls between the host and guest of requests sampled
+// by the recorder, such as to Replay them later. Sampled requests are handled
+// by a new guest, discarded afterwards, so that the recording doesn't depend
+// on earlier requests. This slows them down, so sample only a few in
+// production.
+func Record(recorder Recorder) Option {
+	return func(h *options) {
+		h.recorder = recorder
+	}
+}
+
 type options struct {
 	newRuntime   func(context.Context) (wazero.Runtime, error)
 	guestConfig  []byte
 	moduleConfig wazero.ModuleConfig
 	logger       api.Logger
+	matchers     []Matcher
+	metrics      api.Metrics
+
+	decodeContent   bool
+	contentDecoding ContentEncodingPolicy
+	etagPolicy      ETagPolicy
+	shutdownTimeout time.Duration
+	tickInterval    time.Duration
+	logGuestOutput  bool
+	stdoutLevel     api.LogLevel
+	stderrLevel     api.LogLevel
+	sandbox         *SandboxPolicy
+	importPolicy    *ImportPolicy
+	verifier        verify.Verifier
+	allowedFeatures *handler.Features
+	recorder        Recorder
 }
 
-// DefaultRuntime implements options.newRuntime.
+// DefaultRuntime implements options.newRuntime. Guests abort when the
+// context.Context of their request is done, such as when the client
+// disconnects. Instantiating a guest for the pool isn't aborted, as other
+// requests use it.
 func DefaultRuntime(ctx context.Context) (wazero.Runtime, error) {
-	return wazero.NewRuntime(ctx), nil
+	config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true)
+	return wazero.NewRuntimeWithConfig(ctx, config), nil
 }
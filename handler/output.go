@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/http-wasm/http-wasm-host-go/api"
+)
+
+// guestOutput logs lines a guest writes to STDOUT and STDERR, correlating
+// them with the context of the current call into the guest.
+type guestOutput struct {
+	// ctx is the context of the current call into the guest, or nil.
+	ctx            context.Context
+	stdout, stderr lineWriter
+}
+
+func newGuestOutput(logger api.Logger, name string, stdoutLevel, stderrLevel api.LogLevel) *guestOutput {
+	o := &guestOutput{}
+	o.stdout = lineWriter{out: o, logger: logger, name: name, level: stdoutLevel}
+	o.stderr = lineWriter{out: o, logger: logger, name: name, level: stderrLevel}
+	return o
+}
+
+// bind correlates output with ctx until flushed.
+func (o *guestOutput) bind(ctx context.Context) {
+	o.ctx = ctx
+}
+
+// flush logs any partial lines and unbinds the context.
+func (o *guestOutput) flush() {
+	o.stdout.flush()
+	o.stderr.flush()
+	o.ctx = nil
+}
+
+// lineWriter logs each line written, buffering any partial line.
+type lineWriter struct {
+	out    *guestOutput
+	logger api.Logger
+	name   string
+	level  api.LogLevel
+	buf    []byte
+}
+
+// Write implements io.Writer
+func (w *lineWriter) Write(p []byte) (int, error) {
+	if !w.logger.IsEnabled(w.level) {
+		return len(p), nil
+	}
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.log(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *lineWriter) flush() {
+	if len(w.buf) > 0 {
+		w.log(w.buf)
+		w.buf = w.buf[:0]
+	}
+}
+
+// log logs the line, tagged with the guest name and any request ID.
+func (w *lineWriter) log(line []byte) {
+	ctx := w.out.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	prefix := w.name
+	if id := api.RequestID(ctx); id != "" {
+		prefix += " [" + id + "]"
+	}
+	w.logger.Log(ctx, w.level, prefix+": "+string(bytes.TrimSuffix(line, []byte{'\r'})))
+}
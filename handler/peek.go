@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"io"
+
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
+)
+
+var _ handler.BodyPeeker = (*peekingReader)(nil)
+
+// peekingReader implements handler.BodyPeeker by reading ahead of the
+// delegate, for bodies whose reader doesn't.
+type peekingReader struct {
+	delegate io.ReadCloser
+	// peeked are bytes read ahead of the delegate, but not yet by Read.
+	peeked []byte
+}
+
+// Read reads any peeked bytes before the delegate.
+func (r *peekingReader) Read(p []byte) (int, error) {
+	if len(r.peeked) == 0 {
+		return r.delegate.Read(p)
+	}
+	n := copy(p, r.peeked)
+	r.peeked = r.peeked[n:]
+	return n, nil
+}
+
+// PeekAt implements handler.BodyPeeker
+func (r *peekingReader) PeekAt(p []byte, off int64) (n int, err error) {
+	r.peeked, err = readAhead(r.delegate, r.peeked, int(off)+len(p))
+	if start := int(off); start < len(r.peeked) {
+		n = copy(p, r.peeked[start:])
+	}
+	if n == len(p) {
+		err = nil
+	}
+	return
+}
+
+// Close dispatches to the delegate.
+func (r *peekingReader) Close() error {
+	return r.delegate.Close()
+}
+
+// readAhead appends to buf from r until it has the given length or r errs.
+func readAhead(r io.Reader, buf []byte, length int) ([]byte, error) {
+	if cap(buf) < length {
+		grown := make([]byte, len(buf), length)
+		copy(grown, buf)
+		buf = grown
+	}
+	var err error
+	for len(buf) < length && err == nil {
+		var n int
+		n, err = r.Read(buf[len(buf):length])
+		buf = buf[:len(buf)+n]
+	}
+	return buf, err
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	wazeroapi "github.com/tetratelabs/wazero/api"
+)
+
+// Recorder receives the calls between the host and guest of sampled
+// requests. See Record.
+type Recorder interface {
+	// Sample returns true to record the current request. This is called
+	// before the guest handles it.
+	Sample(ctx context.Context) bool
+
+	// Record is called with the recording of a sampled request, once the
+	// guest finished handling it. The recording can be passed to Replay.
+	Record(ctx context.Context, recording *Recording)
+}
+
+// Recording is the calls between the host and guest while handling a
+// request, in order. It starts with the calls made while the guest
+// initialized, and is JSON serializable.
+type Recording struct {
+	Calls []Call `json:"calls"`
+}
+
+// Call is a call from the host to a guest function, such as
+// handler.FuncHandleRequest, or from the guest to a host function, such as
+// handler.FuncGetURI.
+type Call struct {
+	// Func is the name of the function.
+	Func string `json:"func"`
+
+	// Guest is true if the host called the guest.
+	Guest bool `json:"guest,omitempty"`
+
+	// Params are the parameters of the call.
+	Params []uint64 `json:"params"`
+
+	// Results are the results of the call, unless it failed.
+	Results []uint64 `json:"results"`
+
+	// Memory are the writes the host function made to guest memory.
+	Memory []MemoryWrite `json:"memory,omitempty"`
+
+	// Panic is the message of the panic that trapped the guest, if the host
+	// function panicked.
+	Panic string `json:"panic,omitempty"`
+
+	// Error is the error calling the guest function, if it failed.
+	Error string `json:"error,omitempty"`
+}
+
+// String returns the call like "get_uri(1024, 1024)".
+func (c *Call) String() string {
+	params := make([]string, 0, len(c.Params))
+	for _, p := range c.Params {
+		params = append(params, fmt.Sprint(p))
+	}
+	kind := "host"
+	if c.Guest {
+		kind = "guest"
+	}
+	return fmt.Sprintf("%s %s(%s)", kind, c.Func, strings.Join(params, ", "))
+}
+
+// MemoryWrite is data written to guest memory at the offset.
+type MemoryWrite struct {
+	Offset uint32 `json:"offset"`
+	Data   []byte `json:"data"`
+}
+
+// recordingKey is a context.Context value associated with the *Recording of
+// the current request or guest initialization.
+type recordingKey struct{}
+
+func recordingFromContext(ctx context.Context) *Recording {
+	rec, _ := ctx.Value(recordingKey{}).(*Recording)
+	return rec
+}
+
+// record calls the function, appending it to the recording. Host functions
+// pass the memory they use, to record writes to it.
+func (r *Recording) record(c Call, stack []uint64, results int, mem *recordingMemory, call func()) {
+	i := len(r.Calls)
+	r.Calls = append(r.Calls, c)
+	defer func() {
+		c := &r.Calls[i]
+		if mem != nil {
+			c.Memory = mem.writes()
+		}
+		if recovered := recover(); recovered != nil {
+			c.Panic = fmt.Sprint(recovered)
+			panic(recovered)
+		}
+		c.Results = append([]uint64{}, stack[:results]...)
+	}()
+	call()
+}
+
+// recordGuest calls the guest function, appending it to the recording.
+func (r *Recording) recordGuest(ctx context.Context, fn wazeroapi.Function, params []uint64) (results []uint64, err error) {
+	i := len(r.Calls)
+	r.Calls = append(r.Calls, Call{
+		Func:   fn.Definition().ExportNames()[0],
+		Guest:  true,
+		Params: append([]uint64{}, params...),
+	})
+	if results, err = fn.Call(ctx, params...); err != nil {
+		r.Calls[i].Error = err.Error()
+	} else {
+		r.Calls[i].Results = append([]uint64{}, results...)
+	}
+	return
+}
+
+// recordModuleFunc returns fn, recording its calls in sampled requests.
+func (m *middleware) recordModuleFunc(name string, fn wazeroapi.GoModuleFunc) wazeroapi.GoModuleFunc {
+	if m.recorder == nil {
+		return fn
+	}
+	return func(ctx context.Context, mod wazeroapi.Module, stack []uint64) {
+		rec := recordingFromContext(ctx)
+		if rec == nil {
+			fn(ctx, mod, stack)
+			return
+		}
+		def := m.hostFuncs[name]
+		mem := &recordingMemory{Memory: mod.Memory()}
+		c := Call{Func: name, Params: append([]uint64{}, stack[:len(def.ParamTypes())]...)}
+		rec.record(c, stack, len(def.ResultTypes()), mem, func() {
+			fn(ctx, &recordingModule{Module: mod, memory: mem}, stack)
+		})
+	}
+}
+
+// recordFunc is like recordModuleFunc, except for host functions that don't
+// use the module.
+func (m *middleware) recordFunc(name string, fn wazeroapi.GoFunc) wazeroapi.GoFunc {
+	if m.recorder == nil {
+		return fn
+	}
+	return func(ctx context.Context, stack []uint64) {
+		rec := recordingFromContext(ctx)
+		if rec == nil {
+			fn(ctx, stack)
+			return
+		}
+		def := m.hostFuncs[name]
+		c := Call{Func: name, Params: append([]uint64{}, stack[:len(def.ParamTypes())]...)}
+		rec.record(c, stack, len(def.ResultTypes()), nil, func() {
+			fn(ctx, stack)
+		})
+	}
+}
+
+// record passes the recording of the request, if sampled, to the Recorder.
+func (m *middleware) record(ctx context.Context, s *requestState) {
+	if s.recording != nil {
+		m.recorder.Record(ctx, s.recording)
+	}
+}
+
+// recordingModule returns a recordingMemory from Memory.
+type recordingModule struct {
+	wazeroapi.Module
+	memory *recordingMemory
+}
+
+// Memory implements the same method as documented on api.Module.
+func (m *recordingModule) Memory() wazeroapi.Memory {
+	return m.memory
+}
+
+// recordingMemory tracks the regions a host function reads or writes.
+// Regions read are tracked as host functions write into them, such as when
+// reading a body. Otherwise, host functions only write with Write and
+// WriteString.
+type recordingMemory struct {
+	wazeroapi.Memory
+	regions []memoryRegion
+}
+
+type memoryRegion struct {
+	offset, length uint32
+
+	// read is a copy of a region read, to tell if it was written. This is
+	// nil if the region was written.
+	read []byte
+}
+
+// writes returns the regions that were written.
+func (m *recordingMemory) writes() (writes []MemoryWrite) {
+	for _, r := range m.regions {
+		data, _ := m.Memory.Read(r.offset, r.length)
+		if r.read != nil && bytes.Equal(r.read, data) {
+			continue
+		}
+		writes = append(writes, MemoryWrite{Offset: r.offset, Data: append([]byte{}, data...)})
+	}
+	return
+}
+
+func (m *recordingMemory) written(offset, length uint32, ok bool) bool {
+	if ok && length > 0 {
+		m.regions = append(m.regions, memoryRegion{offset: offset, length: length})
+	}
+	return ok
+}
+
+// Read implements the same method as documented on api.Memory.
+func (m *recordingMemory) Read(offset, byteCount uint32) ([]byte, bool) {
+	buf, ok := m.Memory.Read(offset, byteCount)
+	if ok && byteCount > 0 {
+		m.regions = append(m.regions, memoryRegion{offset: offset, length: byteCount, read: append([]byte{}, buf...)})
+	}
+	return buf, ok
+}
+
+// Write implements the same method as documented on api.Memory.
+func (m *recordingMemory) Write(offset uint32, v []byte) bool {
+	return m.written(offset, uint32(len(v)), m.Memory.Write(offset, v))
+}
+
+// WriteString implements the same method as documented on api.Memory.
+func (m *recordingMemory) WriteString(offset uint32, v string) bool {
+	return m.written(offset, uint32(len(v)), m.Memory.WriteString(offset, v))
+}
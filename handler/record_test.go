@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
+	"github.com/http-wasm/http-wasm-host-go/internal/test"
+)
+
+type uriHost struct {
+	handler.UnimplementedHost
+	body *bytes.Buffer
+}
+
+func (uriHost) GetURI(context.Context) string { return "/a?b" }
+
+func (uriHost) SetURI(context.Context, string) {}
+
+func (h uriHost) RequestBodyWriter(context.Context) io.Writer { return h.body }
+
+// sliceRecorder samples requests if sample, except the first skip ones,
+// appending their recordings.
+type sliceRecorder struct {
+	sample     bool
+	skip       int
+	recordings []*Recording
+}
+
+func (r *sliceRecorder) Sample(context.Context) bool {
+	if r.skip > 0 {
+		r.skip--
+		return false
+	}
+	return r.sample
+}
+
+func (r *sliceRecorder) Record(_ context.Context, recording *Recording) {
+	r.recordings = append(r.recordings, recording)
+}
+
+func TestMiddlewareRecord(t *testing.T) {
+	tests := []struct {
+		name               string
+		sample             bool
+		expectedRecordings int
+	}{
+		{name: "sampled", sample: true, expectedRecordings: 1},
+		{name: "not sampled"},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := &sliceRecorder{sample: tc.sample}
+			mw, err := NewMiddleware(testCtx, test.BinE2EURI, uriHost{body: &bytes.Buffer{}}, Record(recorder))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mw.Close(testCtx)
+
+			handleRequestAndResponse(t, mw)
+			if want, have := tc.expectedRecordings, len(recorder.recordings); want != have {
+				t.Fatalf("unexpected recordings, want: %d, have: %d", want, have)
+			}
+			if !tc.sample {
+				return
+			}
+
+			expected := []Call{
+				{Func: handler.FuncHandleRequest, Guest: true, Params: []uint64{}, Results: []uint64{1}},
+				{Func: handler.FuncGetURI, Params: []uint64{1024, 1024}, Results: []uint64{4}, Memory: []MemoryWrite{{Offset: 1024, Data: []byte("/a?b")}}},
+				{Func: handler.FuncSetURI, Params: []uint64{0, 0}, Results: []uint64{}},
+				{Func: handler.FuncSetURI, Params: []uint64{0, 22}, Results: []uint64{}},
+				{Func: handler.FuncWriteBody, Params: []uint64{0, 1024, 4}, Results: []uint64{}},
+				{Func: handler.FuncHandleResponse, Guest: true, Params: []uint64{0, 0}, Results: []uint64{}},
+			}
+			if have := recorder.recordings[0].Calls; !reflect.DeepEqual(expected, have) {
+				t.Errorf("unexpected calls, want: %+v, have: %+v", expected, have)
+			}
+		})
+	}
+}
+
+func TestReplay(t *testing.T) {
+	recorder := &sliceRecorder{sample: true}
+	mw, err := NewMiddleware(testCtx, test.BinE2EURI, uriHost{body: &bytes.Buffer{}}, Record(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+	handleRequestAndResponse(t, mw)
+	recording := recorder.recordings[0]
+
+	if err = Replay(testCtx, test.BinE2EURI, recording); err != nil {
+		t.Fatal(err)
+	}
+
+	// Replay a different URI length, which the guest passes to write_body.
+	tampered := &Recording{Calls: append([]Call{}, recording.Calls...)}
+	tampered.Calls[1].Results = []uint64{3}
+	err = Replay(testCtx, test.BinE2EURI, tampered)
+	var replayErr *ReplayError
+	if !errors.As(err, &replayErr) {
+		t.Fatalf("expected a replay error, have: %v", err)
+	}
+	if want, have := 4, replayErr.Index; want != have {
+		t.Errorf("unexpected index, want: %d, have: %d", want, have)
+	}
+	want := "wasm: guest diverged from recording at call 4: expected host write_body(0, 1024, 4), but the guest called host write_body(0, 1024, 3)"
+	if have := replayErr.Error(); want != have {
+		t.Errorf("unexpected error, want: %s, have: %s", want, have)
+	}
+
+	// Replay a recording that ends early.
+	truncated := &Recording{Calls: recording.Calls[:2]}
+	err = Replay(testCtx, test.BinE2EURI, truncated)
+	want = "wasm: guest diverged from recording at call 2: expected no more calls, but the guest called host set_uri(0, 0)"
+	requireEqualError(t, err, want)
+}
+
+// TestReplay_SecondRequest ensures a request sampled after the guest handled
+// another can be replayed, even though the guest has state, here a counter.
+func TestReplay_SecondRequest(t *testing.T) {
+	recorder := &sliceRecorder{sample: true, skip: 1}
+	mw, err := NewMiddleware(testCtx, test.BinE2EHandleResponse, handler.UnimplementedHost{}, Record(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mw.Close(testCtx)
+	handleRequestAndResponse(t, mw)
+	handleRequestAndResponse(t, mw)
+
+	if want, have := 1, len(recorder.recordings); want != have {
+		t.Fatalf("unexpected recordings, want: %d, have: %d", want, have)
+	}
+	if err = Replay(testCtx, test.BinE2EHandleResponse, recorder.recordings[0]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func handleRequestAndResponse(t *testing.T, mw Middleware) {
+	t.Helper()
+	ctx, ctxNext, err := mw.HandleRequest(testCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mw.HandleResponse(ctx, uint32(ctxNext>>32), nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tetratelabs/wazero"
+	wazeroapi "github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
+)
+
+// ReplayError is returned by Replay when the guest diverges from the
+// recording.
+type ReplayError struct {
+	// Index is that of the recorded call where the guest diverged.
+	Index int
+
+	// Expected is the recorded call, or nil if the guest made more calls
+	// than were recorded.
+	Expected *Call
+
+	// Actual is what happened instead.
+	Actual string
+}
+
+// Error implements error
+func (e *ReplayError) Error() string {
+	if e.Expected == nil {
+		return fmt.Sprintf("wasm: guest diverged from recording at call %d: expected no more calls, but %s", e.Index, e.Actual)
+	}
+	return fmt.Sprintf("wasm: guest diverged from recording at call %d: expected %s, but %s", e.Index, e.Expected, e.Actual)
+}
+
+// Replay runs the guest against a recording made with Record, without a
+// host or HTTP server. Guest functions are called with the recorded
+// parameters, and host functions return the recorded results, writing the
+// recorded memory. This runs the guest the same way each time, such as to
+// step through it in a debugger.
+//
+// Like the recorded guest, the guest is new, so it doesn't have state from
+// other requests. Calls to WASI functions aren't recorded, though, which
+// can make the guest diverge from the recording, returning a *ReplayError.
+func Replay(ctx context.Context, guest []byte, recording *Recording) error {
+	r := wazero.NewRuntime(ctx)
+	defer r.Close(ctx)
+
+	compiled, err := r.CompileModule(ctx, guest)
+	if err != nil {
+		return fmt.Errorf("wasm: error compiling guest: %w", err)
+	}
+
+	rp := &replayer{calls: recording.Calls}
+	host := r.NewHostModuleBuilder(handler.HostModule)
+	for _, f := range compiled.ImportedFunctions() {
+		moduleName, name, _ := f.Import()
+		switch moduleName {
+		case handler.HostModule:
+			host.NewFunctionBuilder().
+				WithGoModuleFunction(rp.hostFunc(name, len(f.ParamTypes()), len(f.ResultTypes())), f.ParamTypes(), f.ResultTypes()).
+				Export(name)
+		case wasi_snapshot_preview1.ModuleName:
+			if r.Module(moduleName) == nil {
+				if _, err = wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+					return fmt.Errorf("wasm: error instantiating wasi: %w", err)
+				}
+			}
+		}
+	}
+	if _, err = host.Instantiate(ctx); err != nil {
+		return fmt.Errorf("wasm: error instantiating host: %w", err)
+	}
+
+	mod, err := r.InstantiateModule(ctx, compiled, wazero.NewModuleConfig())
+	if rp.err != nil {
+		return rp.err
+	} else if err != nil {
+		return fmt.Errorf("wasm: error instantiating guest: %w", err)
+	}
+
+	for rp.next < len(rp.calls) {
+		i := rp.next
+		c := &rp.calls[i]
+		if !c.Guest {
+			return &ReplayError{Index: i, Expected: c, Actual: "the guest didn't call it"}
+		}
+		rp.next++
+
+		fn := mod.ExportedFunction(c.Func)
+		if fn == nil {
+			return &ReplayError{Index: i, Expected: c, Actual: "the guest doesn't export it"}
+		}
+		results, err := fn.Call(ctx, c.Params...)
+		switch {
+		case rp.err != nil:
+			return rp.err
+		case err != nil && c.Error == "":
+			return &ReplayError{Index: i, Expected: c, Actual: fmt.Sprintf("it failed: %v", err)}
+		case err == nil && c.Error != "":
+			return &ReplayError{Index: i, Expected: c, Actual: "it succeeded"}
+		case err == nil && !equalStack(c.Results, results):
+			return &ReplayError{Index: i, Expected: c, Actual: fmt.Sprintf("it returned %v", results)}
+		}
+	}
+	return nil
+}
+
+// replayer serves host functions from the recorded calls, in order.
+type replayer struct {
+	calls []Call
+	next  int
+
+	// err is the first divergence, which also traps the guest.
+	err *ReplayError
+}
+
+func (rp *replayer) hostFunc(name string, params, results int) wazeroapi.GoModuleFunc {
+	return func(_ context.Context, mod wazeroapi.Module, stack []uint64) {
+		if rp.err != nil {
+			panic(rp.err)
+		}
+		actual := &Call{Func: name, Params: stack[:params]}
+		i := rp.next
+		if i >= len(rp.calls) {
+			rp.err = &ReplayError{Index: i, Actual: "the guest called " + actual.String()}
+			panic(rp.err)
+		}
+		c := &rp.calls[i]
+		if c.Guest || c.Func != name || !equalStack(c.Params, actual.Params) {
+			rp.err = &ReplayError{Index: i, Expected: c, Actual: "the guest called " + actual.String()}
+			panic(rp.err)
+		}
+		rp.next++
+
+		for _, w := range c.Memory {
+			if !mod.Memory().Write(w.Offset, w.Data) {
+				rp.err = &ReplayError{Index: i, Expected: c, Actual: "its memory writes are out of range"}
+				panic(rp.err)
+			}
+		}
+		if c.Panic != "" {
+			panic(errors.New(c.Panic))
+		}
+		copy(stack[:results], c.Results)
+	}
+}
+
+func equalStack(a, b []uint64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
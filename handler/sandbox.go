@@ -0,0 +1,116 @@
+package handler
+
+import (
+	"crypto/rand"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/tetratelabs/wazero"
+	wazeroapi "github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// SandboxPolicy declares the WASI capabilities granted to the guest. See
+// Sandbox.
+type SandboxPolicy struct {
+	// Mounts are host directories the guest can read, keyed by the path
+	// the guest sees. For example, {"/data": "/etc/myapp/data"}. Mounts are
+	// read-only.
+	Mounts map[string]string
+
+	// Env are names of host environment variables the guest can read, if
+	// set. Others are invisible to the guest.
+	Env []string
+
+	// Deterministic keeps the clocks and random source of the guest fake, as
+	// they are by default in wazero.ModuleConfig. This makes tests
+	// reproducible. Otherwise, the guest uses the system clocks and
+	// crypto/rand.
+	Deterministic bool
+
+	// Deny fails NewMiddleware when the guest imports WASI functions outside
+	// the policy, such as "path_open" without Mounts, or any that write
+	// files or use sockets.
+	Deny bool
+}
+
+// wasiBase are WASI functions a guest can import regardless of the policy,
+// as they don't access host resources other than clocks, random and STDIO.
+var wasiBase = []string{
+	"args_get", "args_sizes_get",
+	"clock_res_get", "clock_time_get", "poll_oneoff", "sched_yield",
+	"fd_close", "fd_fdstat_get", "fd_prestat_dir_name", "fd_prestat_get", "fd_write",
+	"proc_exit", "random_get",
+}
+
+// wasiEnv are WASI functions that require SandboxPolicy.Env.
+var wasiEnv = []string{"environ_get", "environ_sizes_get"}
+
+// wasiRead are WASI functions that require SandboxPolicy.Mounts.
+var wasiRead = []string{
+	"fd_advise", "fd_fdstat_set_flags", "fd_filestat_get", "fd_pread", "fd_read",
+	"fd_readdir", "fd_seek", "fd_tell", "path_filestat_get", "path_open",
+	"path_readlink",
+}
+
+// moduleConfig returns a config with only the capabilities of the policy.
+func (p *SandboxPolicy) moduleConfig() wazero.ModuleConfig {
+	config := wazero.NewModuleConfig()
+	if len(p.Mounts) > 0 {
+		fsConfig := wazero.NewFSConfig()
+		for guestPath, dir := range p.Mounts {
+			fsConfig = fsConfig.WithReadOnlyDirMount(dir, guestPath)
+		}
+		config = config.WithFSConfig(fsConfig)
+	}
+	for _, name := range p.Env {
+		if value, ok := os.LookupEnv(name); ok {
+			config = config.WithEnv(name, value)
+		}
+	}
+	if !p.Deterministic {
+		config = config.WithSysWalltime().WithSysNanotime().WithSysNanosleep().
+			WithRandSource(rand.Reader)
+	}
+	return config
+}
+
+// checkImports returns an error listing any WASI functions imported by the
+// guest outside the policy, when it denies them.
+func (p *SandboxPolicy) checkImports(importedFns []wazeroapi.FunctionDefinition) error {
+	if !p.Deny {
+		return nil
+	}
+
+	allowed := map[string]struct{}{}
+	allow := func(names []string) {
+		for _, name := range names {
+			allowed[name] = struct{}{}
+		}
+	}
+	allow(wasiBase)
+	if len(p.Env) > 0 {
+		allow(wasiEnv)
+	}
+	if len(p.Mounts) > 0 {
+		allow(wasiRead)
+	}
+
+	var denied []string
+	for _, f := range importedFns {
+		moduleName, name, _ := f.Import()
+		if moduleName != wasi_snapshot_preview1.ModuleName {
+			continue
+		}
+		if _, ok := allowed[name]; !ok {
+			denied = append(denied, name)
+		}
+	}
+	if len(denied) == 0 {
+		return nil
+	}
+	sort.Strings(denied)
+	return fmt.Errorf("wasm: guest imports WASI functions outside the sandbox policy: %s", strings.Join(denied, ", "))
+}
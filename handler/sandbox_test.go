@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tetratelabs/wazero"
+
+	"github.com/http-wasm/http-wasm-host-go/api"
+	"github.com/http-wasm/http-wasm-host-go/api/handler"
+	"github.com/http-wasm/http-wasm-host-go/internal/test"
+)
+
+func TestSandbox(t *testing.T) {
+	t.Setenv("SANDBOX_ALLOWED", "1")
+	t.Setenv("SANDBOX_DENIED", "2")
+
+	// secret.txt is beside the public directory, so isn't mounted with it.
+	dir := t.TempDir()
+	public := filepath.Join(dir, "public")
+	if err := os.Mkdir(public, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// deterministic are the fake clock and random source of wazero.
+	deterministic := `sandbox: clock=1640995200000000000
+sandbox: random=2524941395
+`
+
+	tests := []struct {
+		name           string
+		policy         SandboxPolicy
+		expectedLogs   string
+		unexpectedLogs string
+		expectedError  string
+	}{
+		{
+			name:   "env allowlist",
+			policy: SandboxPolicy{Env: []string{"SANDBOX_ALLOWED", "SANDBOX_UNSET"}, Deterministic: true},
+			expectedLogs: `sandbox: SANDBOX_ALLOWED=1
+sandbox: open=8
+` + deterministic,
+		},
+		{
+			name:          "deny",
+			policy:        SandboxPolicy{Deny: true},
+			expectedError: "wasm: guest imports WASI functions outside the sandbox policy: environ_get, environ_sizes_get, path_open",
+		},
+		{
+			name: "deny allowed",
+			policy: SandboxPolicy{
+				Mounts:        map[string]string{"/data": public},
+				Env:           []string{"SANDBOX_ALLOWED"},
+				Deterministic: true,
+				Deny:          true,
+			},
+			expectedLogs: `sandbox: SANDBOX_ALLOWED=1
+sandbox: open=44
+` + deterministic,
+		},
+		{
+			name:   "mount",
+			policy: SandboxPolicy{Mounts: map[string]string{"/data": dir}, Deterministic: true},
+			expectedLogs: `sandbox: open=0
+` + deterministic,
+		},
+		{
+			name:           "system clock and random",
+			policy:         SandboxPolicy{},
+			unexpectedLogs: deterministic,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			logger := &bufferLogger{}
+			mw, err := NewMiddleware(testCtx, test.BinE2ESandbox, handler.UnimplementedHost{},
+				Sandbox(tc.policy), Logger(logger), GuestOutput(api.LogLevelInfo, api.LogLevelError))
+			requireEqualError(t, err, tc.expectedError)
+			if err != nil {
+				return
+			}
+			defer mw.Close(testCtx)
+
+			if _, _, err = mw.HandleRequest(testCtx); err != nil {
+				t.Fatal(err)
+			}
+			if tc.unexpectedLogs != "" {
+				for _, line := range strings.SplitAfter(tc.unexpectedLogs, "\n") {
+					if have := logger.String(); line != "" && strings.Contains(have, line) {
+						t.Errorf("unexpected log %q in %q", line, have)
+					}
+				}
+			} else if want, have := tc.expectedLogs, logger.String(); want != have {
+				t.Errorf("unexpected logs, want: %q, have: %q", want, have)
+			}
+		})
+	}
+}
+
+func TestSandbox_ModuleConfig(t *testing.T) {
+	config := wazero.NewModuleConfig().WithEnv("SECRET", "hunter2")
+	_, err := NewMiddleware(testCtx, test.BinE2ESandbox, handler.UnimplementedHost{},
+		Sandbox(SandboxPolicy{Env: []string{"SANDBOX_ALLOWED"}}), ModuleConfig(config))
+	requireEqualError(t, err, "wasm: Sandbox can't be combined with ModuleConfig")
+}
@@ -23,10 +23,20 @@ type requestState struct {
 	responseBodyReader io.ReadCloser
 	responseBodyWriter io.Writer
 
+	// hostErr is the error passed to Middleware.HandleResponse, if any.
+	hostErr error
+
+	// inResponseHeaders is true while calling
+	// handler.FuncHandleResponseHeaders.
+	inResponseHeaders bool
+
 	// features are the current request's features which may be more than
 	// Middleware.Features.
 	features handler.Features
 
+	// recording is nil unless the request is sampled by the Recorder.
+	recording *Recording
+
 	putPool func(x any)
 	g       *guest
 }
@@ -46,12 +56,16 @@ func (r *requestState) closeRequest() (err error) {
 }
 
 // Close releases all resources for the current request, including:
-//   - putting the guest module back into the pool
+//   - putting the guest module back into the pool, unless it was closed,
+//     such as when its request was canceled
 //   - releasing any request body resources
 //   - releasing any response body resources
 func (r *requestState) Close() (err error) {
 	if g := r.g; g != nil {
-		r.putPool(r.g)
+		// Discard guests interrupted by wazero, as they are no longer usable.
+		if !g.guest.IsClosed() {
+			r.putPool(g)
+		}
 		r.g = nil
 	}
 	err = r.closeRequest()
@@ -20,6 +20,9 @@ var BinBenchSetURI []byte
 //go:embed testdata/bench/get_header_names.wasm
 var BinBenchGetHeaderNames []byte
 
+//go:embed testdata/bench/get_headers.wasm
+var BinBenchGetHeaders []byte
+
 //go:embed testdata/bench/get_header_values.wasm
 var BinBenchGetHeaderValues []byte
 
@@ -86,15 +89,66 @@ var BinE2EHandleResponse []byte
 //go:embed testdata/e2e/header_names.wasm
 var BinE2EHeaderNames []byte
 
+//go:embed testdata/e2e/headers.wasm
+var BinE2EHeaders []byte
+
+//go:embed testdata/e2e/raw_headers.wasm
+var BinE2ERawHeaders []byte
+
+//go:embed testdata/e2e/reactor.wasm
+var BinE2EReactor []byte
+
+//go:embed testdata/e2e/query_cookies.wasm
+var BinE2EQueryCookies []byte
+
+//go:embed testdata/e2e/response_headers.wasm
+var BinE2EResponseHeaders []byte
+
+//go:embed testdata/e2e/write_body.wasm
+var BinE2EWriteBody []byte
+
+//go:embed testdata/e2e/peek_body.wasm
+var BinE2EPeekBody []byte
+
+//go:embed testdata/e2e/informational.wasm
+var BinE2EInformational []byte
+
+//go:embed testdata/e2e/host_error.wasm
+var BinE2EHostError []byte
+
+//go:embed testdata/e2e/is_canceled.wasm
+var BinE2EIsCanceled []byte
+
+//go:embed testdata/e2e/lifecycle.wasm
+var BinE2ELifecycle []byte
+
+//go:embed testdata/e2e/tick.wasm
+var BinE2ETick []byte
+
+//go:embed testdata/e2e/sandbox.wasm
+var BinE2ESandbox []byte
+
 //go:embed testdata/error/panic_on_handle_request.wasm
 var BinErrorPanicOnHandleRequest []byte
 
 //go:embed testdata/error/panic_on_handle_response.wasm
 var BinErrorPanicOnHandleResponse []byte
 
+//go:embed testdata/error/loop_on_handle_request.wasm
+var BinErrorLoopOnHandleRequest []byte
+
+//go:embed testdata/error/loop_on_handle_response.wasm
+var BinErrorLoopOnHandleResponse []byte
+
+//go:embed testdata/error/get_method_on_tick.wasm
+var BinErrorGetMethodOnTick []byte
+
 //go:embed testdata/error/panic_on_start.wasm
 var BinErrorPanicOnStart []byte
 
+//go:embed testdata/error/panic_on_start_canceled.wasm
+var BinErrorPanicOnStartCanceled []byte
+
 //go:embed testdata/error/set_request_header_after_next.wasm
 var BinErrorSetRequestHeaderAfterNext []byte
 
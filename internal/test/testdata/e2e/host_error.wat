@@ -0,0 +1,80 @@
+(module $host_error
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "get_host_error" (func $get_host_error
+    (param $buf i32) (param $buf_limit i32)
+    (result (; kind << 32| len ;) i64)))
+
+  (import "http_handler" "set_header_value" (func $set_header_value
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)
+    (param $value i32) (param $value_len i32)))
+
+  (import "http_handler" "set_status_code" (func $set_status_code
+    (param $status_code i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $kind_name i32 (i32.const 0))
+  (data (i32.const 0) "x-error-kind")
+  (global $kind_name_len i32 (i32.const 12))
+
+  (global $message_name i32 (i32.const 16))
+  (data (i32.const 16) "x-error")
+  (global $message_name_len i32 (i32.const 7))
+
+  ;; kind is where the ErrorKind is written as a decimal digit.
+  (global $kind i32 (i32.const 32))
+
+  ;; buf is the memory offset past any initialization data.
+  (global $buf i32 (i32.const 64))
+
+  ;; handle_request buffers the response, so that handle_response can change
+  ;; it on error.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (drop (call $enable_features (i32.const 2))) ;; feature_buffer_response
+
+    ;; call the next handler
+    (return (i64.const 1)))
+
+  ;; handle_response copies any host error to response headers, and sets the
+  ;; status to 502.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (local $result i64)
+    (local $len i32)
+
+    (if (i32.eqz (local.get $is_error))
+      (then return))
+
+    ;; result = get_host_error(buf, 1024)
+    (local.set $result
+      (call $get_host_error (global.get $buf) (i32.const 1024)))
+
+    ;; mem[kind] = '0' + uint32(result >> 32)
+    (i32.store8 (global.get $kind)
+      (i32.add
+        (i32.const 48) ;; '0'
+        (i32.wrap_i64 (i64.shr_u (local.get $result) (i64.const 32)))))
+
+    ;; len = uint32(result)
+    (local.set $len (i32.wrap_i64 (local.get $result)))
+
+    ;; if len > 1024 { panic }
+    (if (i32.gt_u (local.get $len) (i32.const 1024))
+      (then unreachable))
+
+    (call $set_header_value
+      (i32.const 1) ;; header_kind_response
+      (global.get $kind_name) (global.get $kind_name_len)
+      (global.get $kind) (i32.const 1))
+
+    (call $set_header_value
+      (i32.const 1) ;; header_kind_response
+      (global.get $message_name) (global.get $message_name_len)
+      (global.get $buf) (local.get $len))
+
+    (call $set_status_code (i32.const 502)))
+)
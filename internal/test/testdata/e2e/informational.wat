@@ -0,0 +1,54 @@
+(module $informational
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "set_header_value" (func $set_header_value
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)
+    (param $value i32) (param $value_len i32)))
+
+  (import "http_handler" "remove_header" (func $remove_header
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)))
+
+  (import "http_handler" "send_informational" (func $send_informational
+    (param $status_code i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $name i32 (i32.const 0))
+  (data (i32.const 0) "Link")
+  (global $name_len i32 (i32.const 4))
+
+  (global $value i32 (i32.const 16))
+  (data (i32.const 16) "</style.css>; rel=preload; as=style")
+  (global $value_len i32 (i32.const 35))
+
+  ;; handle_request sends "103 Early Hints" with a "Link" header, then calls
+  ;; the next handler for the final response.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (if (i32.eqz (i32.and
+                   (call $enable_features (i32.const 64)) ;; feature_informational
+                   (i32.const 64)))
+      (then unreachable)) ;; the host should support informational responses
+
+    (call $set_header_value
+      (i32.const 1) ;; header_kind_response
+      (global.get $name) (global.get $name_len)
+      (global.get $value) (global.get $value_len))
+
+    (call $send_informational (i32.const 103))
+
+    ;; don't send the hint in the final response.
+    (call $remove_header
+      (i32.const 1) ;; header_kind_response
+      (global.get $name) (global.get $name_len))
+
+    ;; call the next handler
+    (return (i64.const 1)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
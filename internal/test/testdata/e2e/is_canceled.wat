@@ -0,0 +1,24 @@
+(module $is_canceled
+
+  (import "http_handler" "is_canceled" (func $is_canceled
+    (result (; canceled ;) i32)))
+
+  (import "http_handler" "set_status_code" (func $set_status_code
+    (param $status_code i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  ;; handle_request simulates a long loop which polls is_canceled to stop
+  ;; early. When canceled, it returns a "503 Service Unavailable" response.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (loop $work
+      (br_if $work (i32.eqz (call $is_canceled))))
+
+    (call $set_status_code (i32.const 503))
+
+    ;; skip the next handler
+    (return (i64.const 0)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
@@ -0,0 +1,47 @@
+(module $lifecycle
+
+  (import "http_handler" "get_config" (func $get_config
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  (import "http_handler" "log" (func $log
+    (param $level i32)
+    (param $buf i32) (param $buf_limit i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $shutdown i32 (i32.const 0))
+  (data (i32.const 0) "shutdown")
+  (global $shutdown_len i32 (i32.const 8))
+
+  ;; config is where the configuration is read.
+  (global $config i32 (i32.const 1024))
+
+  ;; init fails with the configuration as its message, unless it is empty.
+  (func (export "init") (result (; offset << 32| len ;) i64)
+    (local $config_len i32)
+
+    (local.set $config_len
+      (call $get_config (global.get $config) (i32.const 1024)))
+
+    (if (i32.eqz (local.get $config_len))
+      (then (return (i64.const 0)))) ;; success
+
+    (return
+      (i64.or
+        (i64.shl (i64.extend_i32_u (global.get $config)) (i64.const 32))
+        (i64.extend_i32_u (local.get $config_len)))))
+
+  ;; shutdown logs "shutdown" at info level.
+  (func (export "shutdown")
+    (call $log
+      (i32.const 0) ;; log_level_info
+      (global.get $shutdown) (global.get $shutdown_len)))
+
+  ;; handle_request calls the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (return (i64.const 1)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
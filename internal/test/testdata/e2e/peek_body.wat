@@ -0,0 +1,55 @@
+(module $peek_body
+
+  (import "http_handler" "peek_body" (func $peek_body
+    (param $kind i32)
+    (param $offset i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; 0 or EOF(1) << 32 | len ;) i64)))
+
+  (import "http_handler" "set_header_value" (func $set_header_value
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)
+    (param $value i32) (param $value_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $name i32 (i32.const 0))
+  (data (i32.const 0) "x-peek")
+  (global $name_len i32 (i32.const 6))
+
+  ;; buf is the memory offset past any initialization data.
+  (global $buf i32 (i32.const 16))
+
+  ;; handle_request peeks the request body "hello world", copying "world" to
+  ;; the header "x-peek", so that the next handler reads the whole body.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (local $len i32)
+
+    ;; len = uint32(peek_body(body_kind_request, 6, buf, 5))
+    (local.set $len (i32.wrap_i64
+      (call $peek_body
+        (i32.const 0) ;; body_kind_request
+        (i32.const 6) ;; skip "hello "
+        (global.get $buf) (i32.const 5))))
+
+    ;; peeking past the end of the body is EOF.
+    ;; if peek_body(body_kind_request, 0, buf+8, 64) != EOF|11 { panic }
+    (if (i64.ne
+          (call $peek_body
+            (i32.const 0) ;; body_kind_request
+            (i32.const 0)
+            (i32.add (global.get $buf) (i32.const 8)) (i32.const 64))
+          (i64.const 4294967307)) ;; `1<<32|11`
+      (then unreachable))
+
+    (call $set_header_value
+      (i32.const 0) ;; header_kind_request
+      (global.get $name) (global.get $name_len)
+      (global.get $buf) (local.get $len))
+
+    ;; call the next handler
+    (return (i64.const 1)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
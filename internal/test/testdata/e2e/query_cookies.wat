@@ -0,0 +1,81 @@
+(module $query_cookies
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "get_query_values" (func $get_query_values
+    (param $name i32) (param $name_len i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; count << 32| len ;) i64)))
+
+  (import "http_handler" "get_cookie_values" (func $get_cookie_values
+    (param $name i32) (param $name_len i32)
+    (param $buf i32) (param $buf_limit i32)
+    (result (; count << 32| len ;) i64)))
+
+  (import "http_handler" "write_body" (func $write_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $query_name i32 (i32.const 0))
+  (data (i32.const 0) "tag")
+  (global $query_name_len i32 (i32.const 3))
+
+  (global $cookie_name i32 (i32.const 16))
+  (data (i32.const 16) "session")
+  (global $cookie_name_len i32 (i32.const 7))
+
+  (global $unsupported i32 (i32.const 32))
+  (data (i32.const 32) "unsupported")
+  (global $unsupported_len i32 (i32.const 11))
+
+  (global $buf i32 (i32.const 1024))
+  (global $buf_limit i32 (i32.const 1024))
+
+  ;; handle_request writes the NUL-terminated values of the "tag" query
+  ;; parameter, then those of the "session" cookie, to the response body.
+  ;; If the host doesn't support feature_query_cookies, it writes
+  ;; "unsupported" instead.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (local $len i32)
+
+    ;; if enable_features(feature_query_cookies) & feature_query_cookies == 0
+    (if (i32.eqz (i32.and
+          (call $enable_features (i32.const 16)) ;; feature_query_cookies
+          (i32.const 16)))
+      (then
+        (call $write_body
+          (i32.const 1) ;; body_kind_response
+          (global.get $unsupported) (global.get $unsupported_len))
+        (return (i64.const 0))))
+
+    ;; len = uint32(get_query_values("tag"))
+    (local.set $len (i32.wrap_i64
+      (call $get_query_values
+        (global.get $query_name) (global.get $query_name_len)
+        (global.get $buf) (global.get $buf_limit))))
+
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $buf) (local.get $len))
+
+    ;; len = uint32(get_cookie_values("session"))
+    (local.set $len (i32.wrap_i64
+      (call $get_cookie_values
+        (global.get $cookie_name) (global.get $cookie_name_len)
+        (global.get $buf) (global.get $buf_limit))))
+
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $buf) (local.get $len))
+
+    ;; skip any next handler as the response body was written.
+    (return (i64.const 0)))
+
+  ;; handle_response should not be called as handle_request returns zero.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (unreachable))
+)
@@ -0,0 +1,19 @@
+;; reactor is a WASI reactor, which exports "_initialize" instead of "_start".
+(module $reactor
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  ;; next is what handle_request returns. It is one once initialized.
+  (global $next (mut i64) (i64.const 0))
+
+  ;; _initialize must be called before any other export.
+  (func (export "_initialize")
+    (global.set $next (i64.const 1)))
+
+  ;; handle_request proceeds to the next handler if initialized.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (return (global.get $next)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
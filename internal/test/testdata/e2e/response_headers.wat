@@ -0,0 +1,52 @@
+(module $response_headers
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "get_status_code" (func $get_status_code
+    (result (; status_code ;) i32)))
+
+  (import "http_handler" "set_status_code" (func $set_status_code
+    (param $status_code i32)))
+
+  (import "http_handler" "set_header_value" (func $set_header_value
+    (param $kind i32)
+    (param $name i32) (param $name_len i32)
+    (param $value i32) (param $value_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $name i32 (i32.const 0))
+  (data (i32.const 0) "x-hook")
+  (global $name_len i32 (i32.const 6))
+
+  (global $value i32 (i32.const 16))
+  (data (i32.const 16) "1")
+  (global $value_len i32 (i32.const 1))
+
+  ;; handle_request enables response headers and calls the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (if (i32.eqz (i32.and
+                   (call $enable_features (i32.const 32)) ;; feature_response_headers
+                   (i32.const 32)))
+      (then unreachable)) ;; the host should support response headers
+
+    ;; call the next handler
+    (return (i64.const 1)))
+
+  ;; handle_response_headers changes the status and headers of the next
+  ;; handler before they are sent.
+  (func (export "handle_response_headers") (param $reqCtx i32)
+    ;; if get_status_code() == 200 { set_status_code(201) }
+    (if (i32.eq (call $get_status_code) (i32.const 200))
+      (then (call $set_status_code (i32.const 201))))
+
+    (call $set_header_value
+      (i32.const 1) ;; header_kind_response
+      (global.get $name) (global.get $name_len)
+      (global.get $value) (global.get $value_len)))
+
+  ;; handle_response is no-op as the response was already sent.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
@@ -0,0 +1,146 @@
+;; sandbox prints its environment variables to STDOUT, one per line, using
+;; WASI. Then, it prints the errno of opening "secret.txt" in the first
+;; preopened directory, the wall clock and a random number, to test sandbox
+;; policies.
+(module $sandbox
+
+  (import "wasi_snapshot_preview1" "environ_sizes_get" (func $environ_sizes_get
+    (param $result.environc i32) (param $result.environv_len i32)
+    (result (;errno;) i32)))
+
+  (import "wasi_snapshot_preview1" "environ_get" (func $environ_get
+    (param $environ i32) (param $environ_buf i32)
+    (result (;errno;) i32)))
+
+  (import "wasi_snapshot_preview1" "fd_write" (func $fd_write
+    (param $fd i32) (param $iovs i32) (param $iovs_len i32) (param $result.size i32)
+    (result (;errno;) i32)))
+
+  (import "wasi_snapshot_preview1" "path_open" (func $path_open
+    (param $fd i32) (param $dirflags i32) (param $path i32) (param $path_len i32)
+    (param $oflags i32) (param $fs_rights_base i64) (param $fs_rights_inheriting i64)
+    (param $fdflags i32) (param $result.opened_fd i32)
+    (result (;errno;) i32)))
+
+  (import "wasi_snapshot_preview1" "clock_time_get" (func $clock_time_get
+    (param $id i32) (param $precision i64) (param $result.timestamp i32)
+    (result (;errno;) i32)))
+
+  (import "wasi_snapshot_preview1" "random_get" (func $random_get
+    (param $buf i32) (param $buf_len i32)
+    (result (;errno;) i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  ;; environc and environv_len are results of environ_sizes_get.
+  (global $environc i32 (i32.const 0))
+  (global $environv_len i32 (i32.const 4))
+
+  ;; iovec is where the STDOUT iovec is written.
+  (global $iovec i32 (i32.const 8))
+
+  ;; opened_fd, timestamp and random are results of path_open,
+  ;; clock_time_get and random_get.
+  (global $opened_fd i32 (i32.const 16))
+  (global $timestamp i32 (i32.const 24))
+  (global $random i32 (i32.const 32))
+
+  ;; print_iovecs is where $print writes its STDOUT iovecs.
+  (global $print_iovecs i32 (i32.const 48))
+
+  (global $path i32 (i32.const 512))
+  (data (i32.const 512) "secret.txt")
+  (global $path_len i32 (i32.const 10))
+
+  (data (i32.const 600) "open")
+  (data (i32.const 610) "clock")
+  (data (i32.const 620) "random")
+
+  ;; print_end is the end of the buffer $print writes a line to.
+  (global $print_end i32 (i32.const 2240))
+
+  ;; environ is where environ_get writes pointers to each variable.
+  (global $environ i32 (i32.const 64))
+
+  ;; environ_buf is where environ_get writes NUL-terminated variables.
+  (global $environ_buf i32 (i32.const 1024))
+
+  ;; handle_request prints the environment, then skips the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (local $len i32)
+    (local $i i32)
+
+    (drop (call $environ_sizes_get (global.get $environc) (global.get $environv_len)))
+    (drop (call $environ_get (global.get $environ) (global.get $environ_buf)))
+    (local.set $len (i32.load (global.get $environv_len)))
+
+    ;; replace each NUL terminator with a newline.
+    (block $done
+      (loop $next
+        (br_if $done (i32.ge_u (local.get $i) (local.get $len)))
+        (if (i32.eqz (i32.load8_u (i32.add (global.get $environ_buf) (local.get $i))))
+          (then (i32.store8 (i32.add (global.get $environ_buf) (local.get $i)) (i32.const 10))))
+        (local.set $i (i32.add (local.get $i) (i32.const 1)))
+        (br $next)))
+
+    (i32.store (global.get $iovec) (global.get $environ_buf))
+    (i32.store (i32.add (global.get $iovec) (i32.const 4)) (local.get $len))
+    (drop (call $fd_write
+      (i32.const 1) ;; stdout
+      (global.get $iovec)
+      (i32.const 1) ;; only one iovec
+      (i32.const 0))) ;; ignore the result size
+
+    (call $print (i32.const 600) (i32.const 4)
+      (i64.extend_i32_u (call $path_open
+        (i32.const 3) ;; first preopen
+        (i32.const 0) ;; no dirflags
+        (global.get $path) (global.get $path_len)
+        (i32.const 0) ;; no oflags
+        (i64.const 2) ;; fd_read
+        (i64.const 0)
+        (i32.const 0) ;; no fdflags
+        (global.get $opened_fd))))
+
+    (drop (call $clock_time_get
+      (i32.const 0) ;; realtime
+      (i64.const 1)
+      (global.get $timestamp)))
+    (call $print (i32.const 610) (i32.const 5) (i64.load (global.get $timestamp)))
+
+    (drop (call $random_get (global.get $random) (i32.const 4)))
+    (call $print (i32.const 620) (i32.const 6) (i64.load32_u (global.get $random)))
+
+    ;; skip the next handler
+    (return (i64.const 0)))
+
+  ;; print writes a line like "clock=1640995200000000000" to STDOUT.
+  (func $print (param $label i32) (param $label_len i32) (param $value i64)
+    (local $p i32)
+
+    ;; write the value backwards from the newline, then the equals sign.
+    (i32.store8 (global.get $print_end) (i32.const 10))
+    (local.set $p (global.get $print_end))
+    (loop $digit
+      (local.set $p (i32.sub (local.get $p) (i32.const 1)))
+      (i64.store8 (local.get $p)
+        (i64.add (i64.rem_u (local.get $value) (i64.const 10)) (i64.const 48)))
+      (local.set $value (i64.div_u (local.get $value) (i64.const 10)))
+      (br_if $digit (i64.ne (local.get $value) (i64.const 0))))
+    (local.set $p (i32.sub (local.get $p) (i32.const 1)))
+    (i32.store8 (local.get $p) (i32.const 61))
+
+    (i32.store (global.get $print_iovecs) (local.get $label))
+    (i32.store (i32.add (global.get $print_iovecs) (i32.const 4)) (local.get $label_len))
+    (i32.store (i32.add (global.get $print_iovecs) (i32.const 8)) (local.get $p))
+    (i32.store (i32.add (global.get $print_iovecs) (i32.const 12))
+      (i32.sub (i32.add (global.get $print_end) (i32.const 1)) (local.get $p)))
+    (drop (call $fd_write
+      (i32.const 1) ;; stdout
+      (global.get $print_iovecs)
+      (i32.const 2) ;; label and value
+      (i32.const 0)))) ;; ignore the result size
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
@@ -0,0 +1,25 @@
+(module $tick
+
+  (import "http_handler" "log" (func $log
+    (param $level i32)
+    (param $buf i32) (param $buf_limit i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $tick i32 (i32.const 0))
+  (data (i32.const 0) "tick")
+  (global $tick_len i32 (i32.const 4))
+
+  ;; tick logs "tick" at info level.
+  (func (export "tick")
+    (call $log
+      (i32.const 0) ;; log_level_info
+      (global.get $tick) (global.get $tick_len)))
+
+  ;; handle_request calls the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (return (i64.const 1)))
+
+  ;; handle_response is no-op as this is a request-only handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
@@ -0,0 +1,33 @@
+(module $write_body
+
+  (import "http_handler" "enable_features" (func $enable_features
+    (param $enable_features i32)
+    (result (; enabled_features ;) i32)))
+
+  (import "http_handler" "write_body" (func $write_body
+    (param $kind i32)
+    (param $buf i32) (param $buf_len i32)))
+
+  (memory (export "memory") 1 1 (; 1 page==64KB ;))
+
+  (global $body i32 (i32.const 0))
+  (data (i32.const 0) "hello")
+  (global $body_len i32 (i32.const 5))
+
+  ;; handle_request overwrites the request body and calls the next handler.
+  (func (export "handle_request") (result (; ctx_next ;) i64)
+    (drop (call $enable_features (i32.const 2))) ;; feature_buffer_response
+
+    (call $write_body
+      (i32.const 0) ;; body_kind_request
+      (global.get $body) (global.get $body_len))
+
+    ;; call the next handler
+    (return (i64.const 1)))
+
+  ;; handle_response overwrites the response body of the next handler.
+  (func (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (call $write_body
+      (i32.const 1) ;; body_kind_response
+      (global.get $body) (global.get $body_len)))
+)
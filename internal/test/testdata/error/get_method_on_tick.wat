@@ -0,0 +1,19 @@
+;; get_method_on_tick calls a request-scoped function on tick, which the host
+;; should reject as there is no current request.
+(module $get_method_on_tick
+  (import "http_handler" "get_method" (func $get_method
+    (param $buf i32) (param $buf_limit i32)
+    (result (; len ;) i32)))
+
+  ;; Allocate the minimum amount of memory, 1 page (64KB).
+  (memory (export "memory") 1 1)
+
+  ;; On tick, read the method of a request that doesn't exist.
+  (func $tick (export "tick")
+    (drop (call $get_method (i32.const 0) (i32.const 64))))
+
+  (func $handle_request (export "handle_request") (result (; ctx_next ;) i64)
+    (return (i64.const 1)))
+
+  (func $handle_response (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
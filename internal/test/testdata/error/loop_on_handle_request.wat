@@ -0,0 +1,14 @@
+;; loop_on_handle_request never returns from handle_request, without polling
+;; is_canceled. This simulates a guest stuck in a long computation.
+(module $loop_on_handle_request
+
+  ;; Allocate the minimum amount of memory, 1 page (64KB).
+  (memory (export "memory") 1 1)
+
+  ;; On handle_request, loop forever.
+  (func $handle_request (export "handle_request") (result (; ctx_next ;) i64)
+    (loop $forever (br $forever))
+    (unreachable))
+
+  (func $handle_response (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
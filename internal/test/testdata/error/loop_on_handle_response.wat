@@ -0,0 +1,15 @@
+;; loop_on_handle_response never returns from handle_response, without
+;; polling is_canceled. This simulates a guest stuck in a long computation.
+(module $loop_on_handle_response
+
+  ;; Allocate the minimum amount of memory, 1 page (64KB).
+  (memory (export "memory") 1 1)
+
+  ;; On handle_request, call the next handler.
+  (func $handle_request (export "handle_request") (result (; ctx_next ;) i64)
+    (return (i64.const 1)))
+
+  ;; On handle_response, loop forever.
+  (func $handle_response (export "handle_response") (param $reqCtx i32) (param $is_error i32)
+    (loop $forever (br $forever)))
+)
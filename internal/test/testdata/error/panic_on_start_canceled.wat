@@ -0,0 +1,22 @@
+;; panic_on_start_canceled is a WASI command which issues an unreachable
+;; instruction on start when its context is canceled. This simulates wazero
+;; aborting a long "_start" when the client disconnects.
+(module $panic_on_start_canceled
+
+  (import "http_handler" "is_canceled" (func $is_canceled
+    (result (; canceled ;) i32)))
+
+  ;; Allocate the minimum amount of memory, 1 page (64KB).
+  (memory (export "memory") 1 1)
+
+  ;; On start, crash if canceled.
+  (func $main (export "_start")
+    (if (call $is_canceled)
+      (then unreachable)))
+
+  ;; Export the required functions for the handler ABI
+  (func $handle_request (export "handle_request") (result (; ctx_next ;) i64)
+    (return (i64.const 0))) ;; don't call the next handler
+
+  (func $handle_response (export "handle_response") (param $reqCtx i32) (param $is_error i32))
+)
@@ -0,0 +1,266 @@
+// Package loader resolves a guest reference to wasm bytes, to pass to
+// NewMiddleware functions, or to reload a guest.
+//
+// References are one of the following, optionally pinned to the SHA-256
+// digest of the guest by a suffix like "@sha256:<hex>":
+//
+//   - a file path, or a "file://" URL, such as "guests/auth.wasm"
+//   - an "http://" or "https://" URL
+//   - a local OCI image layout directory, such as "oci:guests/auth" or,
+//     with a tag, "oci:guests/auth:v1.0"
+package loader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/http-wasm/http-wasm-host-go/verify"
+)
+
+// Loader loads guests by reference. The zero value is ready to use.
+type Loader struct {
+	// Client fetches "http://" and "https://" references. Defaults to
+	// http.DefaultClient.
+	Client *http.Client
+
+	// CacheDir is a directory of guests fetched by URL, by digest. Pinned
+	// references found there aren't fetched again. Defaults to no cache.
+	CacheDir string
+
+	// Verifier checks the guest after it is loaded, if set.
+	Verifier verify.Verifier
+}
+
+// Load returns the guest bytes of the reference. It fails if the reference
+// is pinned and the guest doesn't match its digest.
+func (l *Loader) Load(ctx context.Context, ref string) ([]byte, error) {
+	location, digest, err := splitDigest(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var guest []byte
+	switch {
+	case strings.HasPrefix(location, "http://"), strings.HasPrefix(location, "https://"):
+		guest, err = l.loadURL(ctx, location, digest)
+	case strings.HasPrefix(location, "oci:"):
+		guest, err = loadOCI(strings.TrimPrefix(location, "oci:"))
+	default:
+		guest, err = os.ReadFile(strings.TrimPrefix(location, "file://"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loader: error loading %s: %w", location, err)
+	}
+
+	if digest != "" {
+		if err = checkDigest(guest, digest); err != nil {
+			return nil, fmt.Errorf("loader: error loading %s: %w", location, err)
+		}
+	}
+	if l.Verifier != nil {
+		if err = l.Verifier.Verify(guest); err != nil {
+			return nil, fmt.Errorf("loader: error verifying %s: %w", location, err)
+		}
+	}
+	return guest, nil
+}
+
+// splitDigest splits the reference into its location and any pinned digest.
+func splitDigest(ref string) (location, digest string, err error) {
+	i := strings.LastIndex(ref, "@sha256:")
+	if i < 0 {
+		return ref, "", nil
+	}
+	location, digest = ref[:i], ref[i+1:]
+	if hexDigest := strings.TrimPrefix(digest, "sha256:"); len(hexDigest) != sha256.Size*2 {
+		return "", "", fmt.Errorf("loader: invalid digest %q", digest)
+	} else if _, err = hex.DecodeString(hexDigest); err != nil {
+		return "", "", fmt.Errorf("loader: invalid digest %q", digest)
+	}
+	return
+}
+
+// Digest returns the digest of the guest, as used in references.
+func Digest(guest []byte) string {
+	sum := sha256.Sum256(guest)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func checkDigest(b []byte, digest string) error {
+	if have := Digest(b); have != strings.ToLower(digest) {
+		return fmt.Errorf("digest mismatch: want %s, have %s", digest, have)
+	}
+	return nil
+}
+
+// loadURL fetches the guest at the URL, unless it is pinned and cached.
+func (l *Loader) loadURL(ctx context.Context, url, digest string) ([]byte, error) {
+	if digest != "" && l.CacheDir != "" {
+		if guest, err := os.ReadFile(l.cachePath(digest)); err == nil && checkDigest(guest, digest) == nil {
+			return guest, nil
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	client := l.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	guest, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.CacheDir != "" {
+		if err = l.cache(guest); err != nil {
+			return nil, err
+		}
+	}
+	return guest, nil
+}
+
+func (l *Loader) cachePath(digest string) string {
+	algorithm, hexDigest, _ := strings.Cut(strings.ToLower(digest), ":")
+	return filepath.Join(l.CacheDir, algorithm, hexDigest)
+}
+
+// cache writes the guest to the cache, by its digest.
+func (l *Loader) cache(guest []byte) error {
+	path := l.cachePath(Digest(guest))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Write to a temporary file first, so that readers never see a partial
+	// guest.
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(guest); err == nil {
+		err = f.Close()
+	} else {
+		_ = f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// ociRefName is the annotation of a manifest in an OCI image index that holds
+// its tag.
+const ociRefName = "org.opencontainers.image.ref.name"
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type ociIndex struct {
+	Manifests []ociDescriptor `json:"manifests"`
+}
+
+type ociManifest struct {
+	Layers []ociDescriptor `json:"layers"`
+}
+
+// loadOCI reads the wasm layer of the image tagged in an OCI image layout
+// directory, such as "guests/auth:v1.0". Without a tag, the layout must have
+// only one image.
+func loadOCI(ref string) ([]byte, error) {
+	dir, tag := ref, ""
+	if i := strings.LastIndex(ref, ":"); i >= 0 && !strings.ContainsAny(ref[i:], `/\`) {
+		dir, tag = ref[:i], ref[i+1:]
+	}
+
+	indexJSON, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	var index ociIndex
+	if err = json.Unmarshal(indexJSON, &index); err != nil {
+		return nil, fmt.Errorf("invalid index.json: %w", err)
+	}
+
+	var manifests []ociDescriptor
+	for _, m := range index.Manifests {
+		if tag == "" || m.Annotations[ociRefName] == tag {
+			manifests = append(manifests, m)
+		}
+	}
+	if len(manifests) != 1 {
+		if tag == "" {
+			return nil, fmt.Errorf("expected one image without a tag, have %d", len(manifests))
+		}
+		return nil, fmt.Errorf("expected one image tagged %q, have %d", tag, len(manifests))
+	}
+
+	manifestJSON, err := readOCIBlob(dir, manifests[0].Digest)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ociManifest
+	if err = json.Unmarshal(manifestJSON, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	layer, err := wasmLayer(manifest.Layers)
+	if err != nil {
+		return nil, err
+	}
+	return readOCIBlob(dir, layer.Digest)
+}
+
+// wasmLayer returns the first layer with a wasm media type, such as
+// "application/vnd.wasm.content.layer.v1+wasm", or the only layer.
+func wasmLayer(layers []ociDescriptor) (ociDescriptor, error) {
+	for _, layer := range layers {
+		if strings.HasSuffix(layer.MediaType, "+wasm") {
+			return layer, nil
+		}
+	}
+	if len(layers) == 1 {
+		return layers[0], nil
+	}
+	return ociDescriptor{}, errors.New("image has no wasm layer")
+}
+
+// readOCIBlob reads a blob from the OCI image layout, checking its digest.
+func readOCIBlob(dir, digest string) ([]byte, error) {
+	algorithm, hexDigest, ok := strings.Cut(digest, ":")
+	if !ok || algorithm != "sha256" {
+		return nil, fmt.Errorf("unsupported digest %q", digest)
+	}
+	blob, err := os.ReadFile(filepath.Join(dir, "blobs", algorithm, filepath.Base(hexDigest)))
+	if err != nil {
+		return nil, err
+	}
+	if err = checkDigest(blob, digest); err != nil {
+		return nil, err
+	}
+	return blob, nil
+}
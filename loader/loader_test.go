@@ -0,0 +1,200 @@
+package loader
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/http-wasm/http-wasm-host-go/internal/test"
+	"github.com/http-wasm/http-wasm-host-go/verify"
+)
+
+var testCtx = context.Background()
+
+func TestLoader(t *testing.T) {
+	guest := test.BinE2EMethod
+	digest := Digest(guest)
+	wrongDigest := Digest(test.BinE2EURI)
+
+	dir := t.TempDir()
+	file := filepath.Join(dir, "guest.wasm")
+	if err := os.WriteFile(file, guest, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	layout := writeOCILayout(t, guest, "v1.0")
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/guest.wasm" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(guest) // nolint
+	}))
+	defer ts.Close()
+
+	tests := []struct {
+		name          string
+		ref           string
+		expectedError string
+	}{
+		{name: "file", ref: file},
+		{name: "file URL", ref: "file://" + file},
+		{name: "file pinned", ref: file + "@" + digest},
+		{
+			name:          "file wrong digest",
+			ref:           file + "@" + wrongDigest,
+			expectedError: "loader: error loading " + file + ": digest mismatch: want " + wrongDigest + ", have " + digest,
+		},
+		{
+			name:          "invalid digest",
+			ref:           file + "@sha256:abcd",
+			expectedError: `loader: invalid digest "sha256:abcd"`,
+		},
+		{name: "OCI", ref: "oci:" + layout},
+		{name: "OCI tag", ref: "oci:" + layout + ":v1.0@" + digest},
+		{
+			name:          "OCI unknown tag",
+			ref:           "oci:" + layout + ":v2.0",
+			expectedError: "loader: error loading oci:" + layout + `:v2.0: expected one image tagged "v2.0", have 0`,
+		},
+		{name: "URL", ref: ts.URL + "/guest.wasm"},
+		{name: "URL pinned", ref: ts.URL + "/guest.wasm@" + digest},
+		{
+			name:          "URL not found",
+			ref:           ts.URL + "/missing.wasm",
+			expectedError: "loader: error loading " + ts.URL + "/missing.wasm: unexpected status: 404 Not Found",
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			l := &Loader{}
+			have, err := l.Load(testCtx, tc.ref)
+			if tc.expectedError != "" {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Fatalf("unexpected error: want %v, have %v", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(have) != string(guest) {
+				t.Error("unexpected guest")
+			}
+		})
+	}
+}
+
+func TestLoader_Cache(t *testing.T) {
+	guest := test.BinE2EMethod
+
+	var fetches atomic.Int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Write(guest) // nolint
+	}))
+	defer ts.Close()
+
+	l := &Loader{CacheDir: t.TempDir()}
+	ref := ts.URL + "/guest.wasm@" + Digest(guest)
+	for i := 0; i < 2; i++ {
+		if _, err := l.Load(testCtx, ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the first load fetches, as the guest is pinned.
+	if want, have := int32(1), fetches.Load(); want != have {
+		t.Errorf("unexpected fetches, want: %d, have: %d", want, have)
+	}
+	if _, err := os.Stat(filepath.Join(l.CacheDir, "sha256", strings.TrimPrefix(Digest(guest), "sha256:"))); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoader_Verifier(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := verify.Embedded(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "guest.wasm")
+	if err = os.WriteFile(file, test.BinE2EMethod, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &Loader{Verifier: verifier}
+	_, err = l.Load(testCtx, file)
+	var sigErr *verify.SignatureError
+	if !errors.As(err, &sigErr) || !sigErr.Unsigned {
+		t.Errorf("expected unsigned error, have: %v", err)
+	}
+}
+
+// writeOCILayout writes an OCI image layout with one image of the guest,
+// returning its directory.
+func writeOCILayout(t *testing.T, guest []byte, tag string) string {
+	t.Helper()
+	dir := t.TempDir()
+
+	writeBlob := func(b []byte) string {
+		digest := Digest(b)
+		path := filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:"))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, b, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return digest
+	}
+	writeJSON := func(v any) []byte {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	config := writeBlob([]byte("{}"))
+	layer := writeBlob(guest)
+	manifest := writeBlob(writeJSON(map[string]any{
+		"schemaVersion": 2,
+		"config":        map[string]any{"mediaType": "application/vnd.wasm.config.v1+json", "digest": config},
+		"layers": []map[string]any{
+			{"mediaType": "application/vnd.wasm.content.layer.v1+wasm", "digest": layer},
+		},
+	}))
+
+	index := writeJSON(map[string]any{
+		"schemaVersion": 2,
+		"manifests": []map[string]any{
+			{
+				"mediaType":   "application/vnd.oci.image.manifest.v1+json",
+				"digest":      manifest,
+				"annotations": map[string]string{ociRefName: tag},
+			},
+		},
+	})
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), index, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
@@ -0,0 +1,134 @@
+package replay
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Change is a difference between what a guest did and what was expected.
+type Change struct {
+	// Field is what differs, such as "next", "status", "request body" or
+	// "response header Content-Type".
+	Field string `json:"field"`
+
+	// Expected is the expected value. Absent headers are empty.
+	Expected string `json:"expected"`
+
+	// Actual is the value from the guest. Absent headers are empty.
+	Actual string `json:"actual"`
+}
+
+// Expectation is what a guest should do with a request. Only fields that are
+// set are checked.
+type Expectation struct {
+	// Next is whether the guest calls the backend.
+	Next *bool `json:"next,omitempty"`
+
+	// StatusCode is the status of the response to the client.
+	StatusCode int `json:"status,omitempty"`
+
+	// Header are response headers that must have these values. A name
+	// without values must be absent.
+	Header http.Header `json:"header,omitempty"`
+
+	// Body is the body of the response to the client.
+	Body *string `json:"body,omitempty"`
+}
+
+// Diff returns the differences between the expected result, such as from a
+// previous version of the guest, and the actual one: whether the guest
+// failed, whether the backend was called, changes to the request it
+// received, and to the response.
+func Diff(expected, actual *Result) (changes []Change) {
+	changes = appendChange(changes, "error", expected.Error, actual.Error)
+	if expected.Next != actual.Next {
+		changes = append(changes, Change{"next", strconv.FormatBool(expected.Next), strconv.FormatBool(actual.Next)})
+	} else if expected.Next && expected.Upstream != nil && actual.Upstream != nil {
+		e, a := expected.Upstream, actual.Upstream
+		changes = appendChange(changes, "request method", e.Method, a.Method)
+		changes = appendChange(changes, "request url", e.URL, a.URL)
+		changes = appendHeaderChanges(changes, "request header ", e.Header, a.Header)
+		changes = appendChange(changes, "request body", e.Body, a.Body)
+	}
+	e, a := &expected.Response, &actual.Response
+	changes = appendChange(changes, "status", strconv.Itoa(e.statusCode()), strconv.Itoa(a.statusCode()))
+	changes = appendHeaderChanges(changes, "response header ", e.Header, a.Header)
+	changes = appendChange(changes, "response body", e.Body, a.Body)
+	return
+}
+
+// Effects returns how the guest changed the exchange, as the differences
+// from passing it through to the backend unchanged.
+func Effects(ex *Exchange, actual *Result) []Change {
+	return Diff(ex.passthrough(), actual)
+}
+
+// passthrough returns the result of a guest that doesn't change the
+// exchange.
+func (ex *Exchange) passthrough() *Result {
+	upstream := &ex.Request
+	if r, scheme, err := ex.Request.newRequest(context.Background()); err == nil {
+		upstream = received(r, scheme)
+	}
+	response := ex.Response
+	response.Header = http.Header{}
+	for n, vs := range ex.Response.Header {
+		for _, v := range vs {
+			response.Header.Add(n, v)
+		}
+	}
+	return &Result{Next: true, Upstream: upstream, Response: response}
+}
+
+// Check returns how the result doesn't meet the expectation.
+func Check(expected *Expectation, actual *Result) (changes []Change) {
+	// An expectation is never met by a guest that failed.
+	changes = appendChange(changes, "error", "", actual.Error)
+	if expected.Next != nil && *expected.Next != actual.Next {
+		changes = append(changes, Change{"next", strconv.FormatBool(*expected.Next), strconv.FormatBool(actual.Next)})
+	}
+	if expected.StatusCode != 0 {
+		changes = appendChange(changes, "status", strconv.Itoa(expected.StatusCode), strconv.Itoa(actual.Response.statusCode()))
+	}
+	for n, v := range expected.Header {
+		field := "response header " + http.CanonicalHeaderKey(n)
+		changes = appendChange(changes, field, strings.Join(v, ", "), strings.Join(actual.Response.Header.Values(n), ", "))
+	}
+	if expected.Body != nil {
+		changes = appendChange(changes, "response body", *expected.Body, actual.Response.Body)
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return
+}
+
+func appendChange(changes []Change, field, expected, actual string) []Change {
+	if expected == actual {
+		return changes
+	}
+	return append(changes, Change{field, expected, actual})
+}
+
+// appendHeaderChanges appends changes to headers, sorted by name.
+func appendHeaderChanges(changes []Change, prefix string, expected, actual http.Header) []Change {
+	names := map[string]struct{}{}
+	for n := range expected {
+		names[http.CanonicalHeaderKey(n)] = struct{}{}
+	}
+	for n := range actual {
+		names[http.CanonicalHeaderKey(n)] = struct{}{}
+	}
+	sorted := make([]string, 0, len(names))
+	for n := range names {
+		sorted = append(sorted, n)
+	}
+	sort.Strings(sorted)
+	for _, n := range sorted {
+		changes = appendChange(changes, prefix+n, strings.Join(expected.Values(n), ", "), strings.Join(actual.Values(n), ", "))
+	}
+	return changes
+}
@@ -0,0 +1,148 @@
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ReadJSONL reads exchanges from JSON lines, each an Exchange. Blank lines
+// are skipped. For example:
+//
+//	{"request": {"method": "GET", "url": "/a"}, "response": {"status": 200, "body": "hello"}}
+func ReadJSONL(r io.Reader) ([]Exchange, error) {
+	var exchanges []Exchange
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64<<20) // allow large bodies
+	for line := 1; scanner.Scan(); line++ {
+		b := bytes.TrimSpace(scanner.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		var ex Exchange
+		if err := json.Unmarshal(b, &ex); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		ex.Request.Header = canonicalHeader(ex.Request.Header)
+		ex.Response.Header = canonicalHeader(ex.Response.Header)
+		exchanges = append(exchanges, ex)
+	}
+	return exchanges, scanner.Err()
+}
+
+// ReadHAR reads exchanges from an HTTP Archive (HAR) 1.2 file, such as saved
+// by a browser. Entries without a response, such as those blocked by the
+// browser, are skipped. As HAR records response bodies decoded, any
+// "Content-Encoding" of the response is removed.
+func ReadHAR(r io.Reader) ([]Exchange, error) {
+	var har struct {
+		Log struct {
+			Entries []harEntry `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return nil, err
+	}
+	exchanges := make([]Exchange, 0, len(har.Log.Entries))
+	for i, e := range har.Log.Entries {
+		if e.Response.Status <= 0 {
+			continue
+		}
+		body, err := e.Response.Content.body()
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		ex := Exchange{
+			Request: Request{
+				Method: e.Request.Method,
+				URL:    e.Request.URL,
+				Header: toHeader(e.Request.Headers),
+			},
+			Response: Response{
+				StatusCode: e.Response.Status,
+				Header:     toHeader(e.Response.Headers),
+				Body:       body,
+			},
+		}
+		// HAR content is decoded, so its headers no longer apply.
+		if ex.Response.Header.Get("Content-Encoding") != "" {
+			ex.Response.Header.Del("Content-Encoding")
+			ex.Response.Header.Del("Content-Length")
+		}
+		if e.Request.PostData != nil {
+			ex.Request.Body = e.Request.PostData.Text
+		}
+		exchanges = append(exchanges, ex)
+	}
+	return exchanges, nil
+}
+
+type harEntry struct {
+	Request struct {
+		Method   string      `json:"method"`
+		URL      string      `json:"url"`
+		Headers  []harHeader `json:"headers"`
+		PostData *struct {
+			Text string `json:"text"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response struct {
+		Status  int         `json:"status"`
+		Headers []harHeader `json:"headers"`
+		Content harContent  `json:"content"`
+	} `json:"response"`
+}
+
+type harHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harContent struct {
+	Text     string `json:"text"`
+	Encoding string `json:"encoding"`
+}
+
+func (c *harContent) body() (string, error) {
+	if c.Encoding != "base64" {
+		return c.Text, nil
+	}
+	b, err := base64.StdEncoding.DecodeString(c.Text)
+	if err != nil {
+		return "", fmt.Errorf("invalid response content: %w", err)
+	}
+	return string(b), nil
+}
+
+// toHeader converts HAR headers, skipping HTTP/2 pseudo-headers such as
+// ":authority", which aren't headers in net/http.
+func toHeader(headers []harHeader) http.Header {
+	header := http.Header{}
+	for _, h := range headers {
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+		header.Add(h.Name, h.Value)
+	}
+	return header
+}
+
+// canonicalHeader returns the header with canonical names, as JSON may have
+// any case.
+func canonicalHeader(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	header := make(http.Header, len(h))
+	for n, vs := range h {
+		for _, v := range vs {
+			header.Add(n, v)
+		}
+	}
+	return header
+}
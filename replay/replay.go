@@ -0,0 +1,224 @@
+// Package replay replays recorded traffic through a guest, to catch changes
+// in its behaviour between versions.
+//
+// Each Exchange is a recorded request and response. Run serves the request
+// with the guest, using a backend that returns the recorded response, and
+// records what the guest did as a Result. Effects reports how the guest
+// changed the exchange, Diff how two results differ, and Check whether a
+// result meets an Expectation.
+package replay
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	wasm "github.com/http-wasm/http-wasm-host-go/handler/nethttp"
+)
+
+// Exchange is a recorded request and its response.
+type Exchange struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+
+	// Expected is what the guest should do with the request, if set.
+	Expected *Expectation `json:"expected,omitempty"`
+}
+
+// Request is an HTTP request.
+type Request struct {
+	Method string `json:"method"`
+
+	// URL is absolute, or origin-form such as "/path?query".
+	URL string `json:"url"`
+
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Response is an HTTP response.
+type Response struct {
+	// StatusCode defaults to 200.
+	StatusCode int         `json:"status,omitempty"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+}
+
+// Result is what a guest did with the request of an Exchange.
+type Result struct {
+	// Next is true if the guest called the backend.
+	Next bool `json:"next"`
+
+	// Upstream is the request the backend received, if Next.
+	Upstream *Request `json:"upstream,omitempty"`
+
+	// Response is what the guest sent to the client.
+	Response Response `json:"response"`
+
+	// Error is why the guest failed the exchange, such as a trap in
+	// handle_response, if it did. Response is what was sent before then.
+	Error string `json:"error,omitempty"`
+}
+
+// Run replays each exchange through the guest in order, returning a result
+// for each. The middleware is shared by all exchanges, as it would be when
+// serving traffic.
+func Run(ctx context.Context, mw wasm.Middleware, exchanges []Exchange) ([]Result, error) {
+	results := make([]Result, 0, len(exchanges))
+	for i := range exchanges {
+		result, err := run(ctx, mw, &exchanges[i])
+		if err != nil {
+			return nil, fmt.Errorf("exchange %d: %w", i, err)
+		}
+		results = append(results, *result)
+	}
+	return results, nil
+}
+
+func run(ctx context.Context, mw wasm.Middleware, ex *Exchange) (*Result, error) {
+	r, scheme, err := ex.Request.newRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{}
+	backend := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result.Next = true
+		result.Upstream = received(r, scheme)
+
+		header := w.Header()
+		for n, vs := range ex.Response.Header {
+			for _, v := range vs {
+				header.Add(n, v)
+			}
+		}
+		w.WriteHeader(ex.Response.statusCode())
+		_, _ = io.WriteString(w, ex.Response.Body)
+	})
+
+	w := &responseRecorder{header: http.Header{}}
+	result.Error = serve(mw.NewHandler(ctx, backend), w, r)
+	result.Response = Response{
+		StatusCode: w.statusCode(),
+		Header:     w.header,
+		Body:       w.body.String(),
+	}
+	return result, nil
+}
+
+// serve serves the request, returning the message of any panic. The
+// handler panics when the guest fails after calling the backend, as the
+// response is already underway.
+func serve(h http.Handler, w http.ResponseWriter, r *http.Request) (err string) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Sprint(recovered)
+		}
+	}()
+	h.ServeHTTP(w, r)
+	return
+}
+
+// newRequest returns the request as received by a server, and the scheme
+// of its URL.
+func (req *Request) newRequest(ctx context.Context) (*http.Request, string, error) {
+	rawURL := req.URL
+	if strings.HasPrefix(rawURL, "/") {
+		rawURL = "http://localhost" + rawURL
+	}
+	method := req.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	r, err := http.NewRequestWithContext(ctx, method, rawURL, strings.NewReader(req.Body))
+	if err != nil {
+		return nil, "", err
+	}
+	if req.Body == "" {
+		r.Body = http.NoBody
+	}
+	for n, vs := range req.Header {
+		if http.CanonicalHeaderKey(n) == "Host" {
+			if len(vs) > 0 {
+				r.Host = vs[0]
+			}
+			continue
+		}
+		for _, v := range vs {
+			r.Header.Add(n, v)
+		}
+	}
+	// Servers see the URL in origin-form.
+	scheme := r.URL.Scheme
+	r.RequestURI = r.URL.RequestURI()
+	r.URL.Scheme, r.URL.Host = "", ""
+	r.RemoteAddr = "127.0.0.1:0"
+	return r, scheme, nil
+}
+
+// received returns the request as received by the backend, reading its
+// body. The URL is absolute, so that changes to the host show.
+func received(r *http.Request, scheme string) *Request {
+	body, _ := io.ReadAll(r.Body)
+	u := *r.URL
+	if u.Scheme == "" {
+		u.Scheme = scheme
+	}
+	if u.Host == "" {
+		u.Host = r.Host
+	}
+	return &Request{
+		Method: r.Method,
+		URL:    u.String(),
+		Header: r.Header.Clone(),
+		Body:   string(body),
+	}
+}
+
+func (resp *Response) statusCode() int {
+	if resp.StatusCode == 0 {
+		return http.StatusOK
+	}
+	return resp.StatusCode
+}
+
+// responseRecorder records the response sent by the guest. Unlike
+// httptest.ResponseRecorder, it doesn't add headers such as "Content-Type",
+// which would look like changes made by the guest.
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+// Header implements http.ResponseWriter
+func (w *responseRecorder) Header() http.Header {
+	return w.header
+}
+
+// Write implements http.ResponseWriter
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(p)
+}
+
+// WriteHeader implements http.ResponseWriter. Informational (1xx) status
+// codes are ignored.
+func (w *responseRecorder) WriteHeader(statusCode int) {
+	if statusCode < 200 || w.status != 0 {
+		return
+	}
+	w.status = statusCode
+}
+
+func (w *responseRecorder) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -2,23 +2,38 @@ package tck
 
 import (
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 )
 
 // BackendHandler is a http.Handler implementing the logic expected by the TCK.
 // It serves to echo back information from the request to the response for
-// checking expectations.
+// checking expectations. It panics with the value of the request header
+// "x-httpwasm-tck-panic", if set.
 func BackendHandler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if msg := r.Header.Get("x-httpwasm-tck-panic"); msg != "" {
+			panic(msg)
+		}
 		w.Header().Set("x-httpwasm-next-method", r.Method)
 		w.Header().Set("x-httpwasm-next-uri", r.RequestURI)
+		w.Header().Set("x-httpwasm-next-host", r.Host)
+		w.Header().Set("x-httpwasm-next-content-length", strconv.FormatInt(r.ContentLength, 10))
 		for k, vs := range r.Header {
 			for i, v := range vs {
 				w.Header().Add(fmt.Sprintf("x-httpwasm-next-header-%s-%d", k, i), v)
 			}
 		}
+
+		// Echo any request body with an explicit length, so that hosts must
+		// correct it if the guest rewrites the response body.
+		if body, _ := io.ReadAll(r.Body); len(body) > 0 {
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Write(body) // nolint
+		}
 	})
 }
 
@@ -0,0 +1,26 @@
+//go:build !tinygo
+
+package main
+
+import _ "unsafe" // for go:linkname
+
+// The guest SDK only exports handle_request and handle_response when built
+// with TinyGo, so they are exported here when built with Go. Go can only
+// call exported functions once its runtime is initialized, so the guest is
+// built as a WASI reactor, whose "_initialize" the host calls first.
+
+//go:linkname sdkHandleRequest github.com/http-wasm/http-wasm-guest-tinygo/handler.handleRequest
+func sdkHandleRequest() uint64
+
+//go:linkname sdkHandleResponse github.com/http-wasm/http-wasm-guest-tinygo/handler.handleResponse
+func sdkHandleResponse(reqCtx, isError uint32)
+
+//go:wasmexport handle_request
+func handleRequest() uint64 {
+	return sdkHandleRequest()
+}
+
+//go:wasmexport handle_response
+func handleResponse(reqCtx, isError uint32) {
+	sdkHandleResponse(reqCtx, isError)
+}
@@ -1,5 +1,5 @@
 module github.com/anuraaga/http-wasm-tck/guest
 
-go 1.19
+go 1.24
 
-require github.com/http-wasm/http-wasm-guest-tinygo v0.3.1-0.20231031134125-487a6e2eec5e
+require github.com/http-wasm/http-wasm-guest-tinygo v0.4.0
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"unsafe"
+
+	"github.com/http-wasm/http-wasm-guest-tinygo/handler/api"
+)
+
+// The host functions below are defined by the "http_handler" module, as
+// documented in api/handler/wasm.go of http-wasm-host-go. The guest SDK
+// doesn't yet support them, so they're imported directly.
+
+//go:wasmimport http_handler get_authority
+func get_authority(buf, bufLimit uint32) uint32
+
+//go:wasmimport http_handler set_authority
+func set_authority(authority, authorityLen uint32)
+
+//go:wasmimport http_handler get_scheme
+func get_scheme(buf, bufLimit uint32) uint32
+
+func getAuthority() string {
+	buf := make([]byte, 64)
+	size := get_authority(ptr(buf), uint32(len(buf)))
+	if size > uint32(len(buf)) { // retry with a larger buffer
+		buf = make([]byte, size)
+		size = get_authority(ptr(buf), size)
+	}
+	return string(buf[:size])
+}
+
+func setAuthority(authority string) {
+	buf := []byte(authority)
+	set_authority(ptr(buf), uint32(len(buf)))
+}
+
+func getScheme() string {
+	buf := make([]byte, 64)
+	size := get_scheme(ptr(buf), uint32(len(buf)))
+	if size > uint32(len(buf)) { // retry with a larger buffer
+		buf = make([]byte, size)
+		size = get_scheme(ptr(buf), size)
+	}
+	return string(buf[:size])
+}
+
+// featureInformational isn't yet defined by the guest SDK.
+const featureInformational api.Features = 1 << 6
+
+//go:wasmimport http_handler send_informational
+func send_informational(statusCode uint32)
+
+//go:wasmimport http_handler get_host_error
+func get_host_error(buf, bufLimit uint32) uint64
+
+func getHostError() (kind uint32, msg string) {
+	buf := make([]byte, 64)
+	kindLen := get_host_error(ptr(buf), uint32(len(buf)))
+	if size := uint32(kindLen); size > uint32(len(buf)) { // retry with a larger buffer
+		buf = make([]byte, size)
+		kindLen = get_host_error(ptr(buf), size)
+	}
+	return uint32(kindLen >> 32), string(buf[:uint32(kindLen)])
+}
+
+//go:wasmimport http_handler peek_body
+func peek_body(kind, offset, buf, bufLimit uint32) uint64
+
+// ptr returns the memory offset of a non-empty buffer.
+func ptr(buf []byte) uint32 {
+	return uint32(uintptr(unsafe.Pointer(&buf[0])))
+}
+
+// featureQueryCookies isn't yet defined by the guest SDK.
+const featureQueryCookies api.Features = 1 << 4
+
+//go:wasmimport http_handler get_query_values
+func get_query_values(name, nameLen, buf, bufLimit uint32) uint64
+
+//go:wasmimport http_handler set_query_value
+func set_query_value(name, nameLen, value, valueLen uint32)
+
+//go:wasmimport http_handler remove_query
+func remove_query(name, nameLen uint32)
+
+//go:wasmimport http_handler get_cookie_values
+func get_cookie_values(name, nameLen, buf, bufLimit uint32) uint64
+
+//go:wasmimport http_handler set_cookie_value
+func set_cookie_value(name, nameLen, value, valueLen uint32)
+
+//go:wasmimport http_handler remove_cookie
+func remove_cookie(name, nameLen uint32)
+
+func getQueryValues(name string) []string {
+	n := []byte(name)
+	buf := make([]byte, 2048)
+	countLen := get_query_values(ptr(n), uint32(len(n)), ptr(buf), uint32(len(buf)))
+	return splitNULTerminated(buf, countLen)
+}
+
+func setQueryValue(name, value string) {
+	n, v := []byte(name), []byte(value)
+	set_query_value(ptr(n), uint32(len(n)), ptr(v), uint32(len(v)))
+}
+
+func removeQuery(name string) {
+	n := []byte(name)
+	remove_query(ptr(n), uint32(len(n)))
+}
+
+func getCookieValues(name string) []string {
+	n := []byte(name)
+	buf := make([]byte, 2048)
+	countLen := get_cookie_values(ptr(n), uint32(len(n)), ptr(buf), uint32(len(buf)))
+	return splitNULTerminated(buf, countLen)
+}
+
+func setCookieValue(name, value string) {
+	n, v := []byte(name), []byte(value)
+	set_cookie_value(ptr(n), uint32(len(n)), ptr(v), uint32(len(v)))
+}
+
+func removeCookie(name string) {
+	n := []byte(name)
+	remove_cookie(ptr(n), uint32(len(n)))
+}
+
+// splitNULTerminated returns the NUL-terminated strings written to buf. The
+// TCK's values are small, so this doesn't retry if the buffer was too small.
+func splitNULTerminated(buf []byte, countLen uint64) []string {
+	count, size := uint32(countLen>>32), uint32(countLen)
+	if count == 0 || size > uint32(len(buf)) {
+		return nil
+	}
+	values := strings.Split(string(buf[:size-1]), "\x00")
+	return values[:count]
+}
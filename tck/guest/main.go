@@ -11,13 +11,28 @@ import (
 
 // TODO: enable_features, get_header, set_header need to be tested separately.
 
-func main() {
-	enabledFeatures := httpwasm.Host.EnableFeatures(api.FeatureBufferRequest | api.FeatureBufferResponse | api.FeatureTrailers)
+// init sets up the handler, as main isn't called in a WASI reactor. See
+// export.go.
+func init() {
+	enabledFeatures := httpwasm.Host.EnableFeatures(api.FeatureBufferRequest | api.FeatureBufferResponse | api.FeatureTrailers | featureQueryCookies | featureInformational)
 	h := handler{enabledFeatures: enabledFeatures}
 
 	httpwasm.HandleRequestFn = h.handleRequest
+	httpwasm.HandleResponseFn = h.handleResponse
 }
 
+func main() {}
+
+const (
+	// reqCtxWriteBodyResponse is the reqCtx of "write_body/response", which
+	// rewrites the response body.
+	reqCtxWriteBodyResponse = 1 + iota
+
+	// reqCtxGetHostError is the reqCtx of "get_host_error", which copies the
+	// host error to the response.
+	reqCtxGetHostError
+)
+
 type handler struct {
 	enabledFeatures api.Features
 }
@@ -72,6 +87,22 @@ func (h *handler) handleRequest(req api.Request, resp api.Response) (next bool,
 		next, reqCtx = h.testSetURI(req, resp, "/animal?name=panda")
 	case "set_uri/query/escaping":
 		next, reqCtx = h.testSetURI(req, resp, "/disney?name=chip%26dale")
+	case "set_uri/absolute":
+		next, reqCtx = h.testSetURI(req, resp, "http://example.com/animal?name=panda")
+	case "get_authority":
+		// The test runner compares this with the request value.
+		resp.Body().WriteString(getAuthority())
+		next = true
+		reqCtx = 0
+	case "set_authority":
+		setAuthority("example.com")
+		next = true
+		reqCtx = 0
+	case "get_scheme":
+		// The test runner compares this with the request value.
+		resp.Body().WriteString(getScheme())
+		next = true
+		reqCtx = 0
 	case "get_header_values/request/lowercase-key":
 		next, reqCtx = h.testGetRequestHeader(req, resp, "single-header", []string{"value"})
 	case "get_header_values/request/mixedcase-key":
@@ -86,6 +117,8 @@ func (h *handler) handleRequest(req api.Request, resp api.Response) (next bool,
 		next, reqCtx = h.testSetRequestHeader(req, resp, "new-header", "value")
 	case "set_header_value/request/existing":
 		next, reqCtx = h.testSetRequestHeader(req, resp, "existing-header", "value")
+	case "set_header_value/request/host":
+		next, reqCtx = h.testSetRequestHeader(req, resp, "host", "example.com")
 	case "add_header_value/request/new":
 		next, reqCtx = h.testAddRequestHeader(req, resp, "new-header", "value")
 	case "add_header_value/request/existing":
@@ -94,6 +127,22 @@ func (h *handler) handleRequest(req api.Request, resp api.Response) (next bool,
 		next, reqCtx = h.testRemoveRequestHeader(req, resp, "new-header")
 	case "remove_header/request/existing":
 		next, reqCtx = h.testRemoveRequestHeader(req, resp, "existing-header")
+	case "get_query_values/request":
+		next, reqCtx = h.testGetValues(resp, "get_query_values", getQueryValues("tag"), []string{"a", "b c"})
+	case "set_query_value/request":
+		setQueryValue("tag", "e")
+		next, reqCtx = true, 0
+	case "remove_query/request":
+		removeQuery("tag")
+		next, reqCtx = true, 0
+	case "get_cookie_values/request":
+		next, reqCtx = h.testGetValues(resp, "get_cookie_values", getCookieValues("session"), []string{"abc"})
+	case "set_cookie_value/request":
+		setCookieValue("session", "xyz")
+		next, reqCtx = true, 0
+	case "remove_cookie/request":
+		removeCookie("session")
+		next, reqCtx = true, 0
 	case "read_body/request/empty":
 		next, reqCtx = h.testReadBody(req, resp, "")
 	case "read_body/request/small":
@@ -104,6 +153,17 @@ func (h *handler) handleRequest(req api.Request, resp api.Response) (next bool,
 		next, reqCtx = h.testReadBody(req, resp, strings.Repeat("a", 4096))
 	case "read_body/request/xlarge":
 		next, reqCtx = h.testReadBody(req, resp, strings.Repeat("a", 5000))
+	case "peek_body/request":
+		next, reqCtx = h.testPeekBody(req, resp, "hello world")
+	case "write_body/request":
+		req.Body().WriteString("hello")
+		next = true
+	case "write_body/response":
+		next, reqCtx = true, reqCtxWriteBodyResponse
+	case "send_informational":
+		next, reqCtx = h.testSendInformational(resp, "</style.css>; rel=preload; as=style")
+	case "get_host_error":
+		next, reqCtx = true, reqCtxGetHostError
 	case "get_source_addr":
 		next, reqCtx = h.testGetSourceAddr(req, resp, "127.0.0.1")
 	default:
@@ -115,6 +175,28 @@ func (h *handler) handleRequest(req api.Request, resp api.Response) (next bool,
 	return
 }
 
+func (h *handler) handleResponse(reqCtx uint32, _ api.Request, resp api.Response, isError bool) {
+	switch reqCtx {
+	case reqCtxWriteBodyResponse:
+		if !isError {
+			resp.Body().WriteString("hello")
+		}
+	case reqCtxGetHostError:
+		h.testGetHostError(resp, isError)
+	}
+}
+
+func (h *handler) testGetHostError(resp api.Response, isError bool) {
+	if !isError {
+		fail(resp, "get_host_error: want isError")
+		return
+	}
+	kind, msg := getHostError()
+	resp.Headers().Set("x-httpwasm-host-error-kind", fmt.Sprint(kind))
+	resp.Headers().Set("x-httpwasm-host-error", msg)
+	resp.SetStatusCode(502)
+}
+
 func (h *handler) testGetMethod(req api.Request, resp api.Response, expectedMethod string) (next bool, reqCtx uint32) {
 	if req.GetMethod() != expectedMethod {
 		fail(resp, fmt.Sprintf("get_method: want %s, have %s", expectedMethod, req.GetMethod()))
@@ -216,6 +298,32 @@ func (h *handler) testReadBody(req api.Request, resp api.Response, expectedBody
 	return true, 0
 }
 
+func (h *handler) testPeekBody(req api.Request, resp api.Response, expectedBody string) (next bool, reqCtx uint32) {
+	// Peek past the first word, then ensure reading the body includes it.
+	buf := make([]byte, 64)
+	eofLen := peek_body(0, 6, ptr(buf), uint32(len(buf)))
+	if have, want := string(buf[:uint32(eofLen)]), expectedBody[6:]; have != want {
+		fail(resp, fmt.Sprintf("peek_body/request: want %s, have %s", want, have))
+		return
+	}
+	if eofLen>>32 != 1 {
+		fail(resp, "peek_body/request: want EOF")
+		return
+	}
+	return h.testReadBody(req, resp, expectedBody)
+}
+
+func (h *handler) testSendInformational(resp api.Response, link string) (next bool, reqCtx uint32) {
+	if h.enabledFeatures&featureInformational == 0 {
+		fail(resp, "send_informational: feature not enabled")
+		return
+	}
+	resp.Headers().Set("Link", link)
+	send_informational(103)
+	resp.Headers().Remove("Link")
+	return true, 0
+}
+
 func (h *handler) testGetSourceAddr(req api.Request, resp api.Response, expectedAddr string) (next bool, reqCtx uint32) {
 	addr := req.GetSourceAddr()
 	raw := strings.Split(addr, ":")
@@ -234,6 +342,24 @@ func (h *handler) testGetSourceAddr(req api.Request, resp api.Response, expected
 	return true, 0
 }
 
+func (h *handler) testGetValues(resp api.Response, hostFn string, have, want []string) (next bool, reqCtx uint32) {
+	if !h.enabledFeatures.IsEnabled(featureQueryCookies) {
+		fail(resp, fmt.Sprintf("%s: feature not enabled", hostFn))
+		return
+	}
+	if len(have) != len(want) {
+		fail(resp, fmt.Sprintf("%s: want %d values, have %d", hostFn, len(want), len(have)))
+		return
+	}
+	for i, v := range have {
+		if v != want[i] {
+			fail(resp, fmt.Sprintf("%s: want %s, have %s", hostFn, want[i], v))
+			return
+		}
+	}
+	return true, 0
+}
+
 func fail(resp api.Response, msg string) {
 	resp.SetStatusCode(500)
 	resp.Headers().Set("x-httpwasm-tck-failed", msg)
@@ -1,10 +1,15 @@
 package tck
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -25,7 +30,7 @@ var GuestWASM []byte
 //
 //	server := httptest.NewServer(h)
 //	tck.Run(t, server.Client(), server.URL)
-func Run(t *testing.T, client *http.Client, url string) {
+func Run(t *testing.T, client *http.Client, url string, opts ...Option) {
 	t.Parallel()
 
 	if url == "" {
@@ -41,25 +46,50 @@ func Run(t *testing.T, client *http.Client, url string) {
 		client: client,
 		url:    url,
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
 
 	r.testGetProtocolVersion()
 	r.testGetMethod()
 	r.testSetMethod()
 	r.testGetURI()
 	r.testSetURI()
+	r.testGetAuthority()
+	r.testSetAuthority()
+	r.testGetScheme()
 	r.testGetHeaderValuesRequest()
 	r.testGetRequestHeaderNamesRequest()
 	r.testSetHeaderValueRequest()
 	r.testAddHeaderValueRequest()
 	r.testRemoveHeaderRequest()
+	r.testQueryRequest()
+	r.testCookieRequest()
 	r.testReadBodyRequest()
+	r.testPeekBodyRequest()
+	r.testWriteBody()
+	r.testSendInformational()
+	r.testGetHostError()
 	r.testGetSourceAddr()
 }
 
+// Option configures Run.
+type Option func(*testRunner)
+
+// RemoteBackend skips tests that need the backend handler to run in the same
+// process as the host, such as get_host_error, which checks the guest sees
+// the backend panic. Use this when the host proxies to the backend.
+func RemoteBackend() Option {
+	return func(r *testRunner) {
+		r.remoteBackend = true
+	}
+}
+
 type testRunner struct {
-	t      *testing.T
-	client *http.Client
-	url    string
+	t             *testing.T
+	client        *http.Client
+	url           string
+	remoteBackend bool
 }
 
 func (r *testRunner) testGetProtocolVersion() {
@@ -186,6 +216,7 @@ func (r *testRunner) testSetURI() {
 	tests := []struct {
 		testID string
 		uri    string
+		host   string
 	}{
 		{
 			testID: "simple",
@@ -203,6 +234,11 @@ func (r *testRunner) testSetURI() {
 			testID: "query/escaping",
 			uri:    "/disney?name=chip%26dale",
 		},
+		{
+			testID: "absolute",
+			uri:    "/animal?name=panda",
+			host:   "example.com",
+		},
 	}
 
 	for _, tc := range tests {
@@ -222,13 +258,97 @@ func (r *testRunner) testSetURI() {
 
 			checkResponse(t, resp)
 
-			if want, have := tt.uri, resp.Header.Get("x-httpwasm-next-uri"); want != have {
+			want, have := tt.uri, resp.Header.Get("x-httpwasm-next-uri")
+			// The backend may see absolute-form as-is or as origin-form.
+			if tt.host != "" && have == "http://"+tt.host+want {
+				have = want
+			}
+			if want != have {
 				t.Errorf("expected uri to be %s, have %s", want, have)
 			}
+			if tt.host == "" {
+				return
+			}
+			if want, have := tt.host, resp.Header.Get("x-httpwasm-next-host"); want != have {
+				t.Errorf("expected host to be %s, have %s", want, have)
+			}
+		})
+	}
+}
+
+func (r *testRunner) testGetAuthority() {
+	hostFn := handler.FuncGetAuthority
+
+	testID := hostFn
+	r.t.Run(testID, func(t *testing.T) {
+		req, err := http.NewRequest("GET", r.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("x-httpwasm-tck-testid", testID)
+		resp, err := r.client.Do(req)
+		if err != nil {
+			t.Error(err)
+		}
+
+		body := checkResponse(t, resp)
+
+		if want, have := req.URL.Host, body; want != have {
+			t.Errorf("expected authority to be %s, have %s", want, have)
+		}
+	})
+}
+
+func (r *testRunner) testSetAuthority() {
+	// Setting the authority and the "Host" header should be equivalent.
+	for _, testID := range []string{handler.FuncSetAuthority, handler.FuncSetHeaderValue + "/request/host"} {
+		testID := testID
+		r.t.Run(testID, func(t *testing.T) {
+			req, err := http.NewRequest("GET", r.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("x-httpwasm-tck-testid", testID)
+			resp, err := r.client.Do(req)
+			if err != nil {
+				t.Error(err)
+			}
+
+			checkResponse(t, resp)
+
+			if want, have := "example.com", resp.Header.Get("x-httpwasm-next-host"); want != have {
+				t.Errorf("expected host to be %s, have %s", want, have)
+			}
 		})
 	}
 }
 
+func (r *testRunner) testGetScheme() {
+	hostFn := handler.FuncGetScheme
+
+	testID := hostFn
+	r.t.Run(testID, func(t *testing.T) {
+		req, err := http.NewRequest("GET", r.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("x-httpwasm-tck-testid", testID)
+		resp, err := r.client.Do(req)
+		if err != nil {
+			t.Error(err)
+		}
+
+		body := checkResponse(t, resp)
+
+		if want, have := req.URL.Scheme, body; want != have {
+			t.Errorf("expected scheme to be %s, have %s", want, have)
+		}
+	})
+}
+
 func (r *testRunner) testGetHeaderValuesRequest() {
 	hostFn := handler.FuncGetHeaderValues
 
@@ -306,6 +426,111 @@ func (r *testRunner) testGetRequestHeaderNamesRequest() {
 	})
 }
 
+func (r *testRunner) testQueryRequest() {
+	tests := []struct {
+		hostFn string
+		want   url.Values
+	}{
+		{
+			hostFn: handler.FuncGetQueryValues,
+			want:   url.Values{"tag": {"a", "b c"}, "other": {"d"}},
+		},
+		{
+			hostFn: handler.FuncSetQueryValue,
+			want:   url.Values{"tag": {"e"}, "other": {"d"}},
+		},
+		{
+			hostFn: handler.FuncRemoveQuery,
+			want:   url.Values{"other": {"d"}},
+		},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		testID := fmt.Sprintf("%s/request", tt.hostFn)
+		r.t.Run(testID, func(t *testing.T) {
+			req, err := http.NewRequest("GET", r.url+"/animal?tag=a&other=d&tag=b%20c", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("x-httpwasm-tck-testid", testID)
+			resp, err := r.client.Do(req)
+			if err != nil {
+				t.Error(err)
+			}
+
+			checkResponse(t, resp)
+
+			// Compare parsed values as the host may re-encode the query.
+			uri, err := url.ParseRequestURI(resp.Header.Get("x-httpwasm-next-uri"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want, have := tt.want, uri.Query(); !reflect.DeepEqual(want, have) {
+				t.Errorf("expected query to be %v, have %v", want, have)
+			}
+		})
+	}
+}
+
+func (r *testRunner) testCookieRequest() {
+	tests := []struct {
+		hostFn string
+		want   []string
+	}{
+		{
+			hostFn: handler.FuncGetCookieValues,
+			want:   []string{"session=abc", "other=def"},
+		},
+		{
+			hostFn: handler.FuncSetCookieValue,
+			want:   []string{"session=xyz", "other=def"},
+		},
+		{
+			hostFn: handler.FuncRemoveCookie,
+			want:   []string{"other=def"},
+		},
+	}
+
+	for _, tc := range tests {
+		tt := tc
+		testID := fmt.Sprintf("%s/request", tt.hostFn)
+		r.t.Run(testID, func(t *testing.T) {
+			req, err := http.NewRequest("GET", r.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Cookie", "session=abc; other=def")
+
+			req.Header.Set("x-httpwasm-tck-testid", testID)
+			resp, err := r.client.Do(req)
+			if err != nil {
+				t.Error(err)
+			}
+
+			checkResponse(t, resp)
+
+			// Parse cookies from the backend as the host may re-encode them.
+			next := &http.Request{Header: http.Header{}}
+			for i := 0; ; i++ {
+				v := resp.Header.Get(fmt.Sprintf("x-httpwasm-next-header-Cookie-%d", i))
+				if v == "" {
+					break
+				}
+				next.Header.Add("Cookie", v)
+			}
+			var have []string
+			for _, c := range next.Cookies() {
+				have = append(have, c.String())
+			}
+			if want := tt.want; !reflect.DeepEqual(want, have) {
+				t.Errorf("expected cookies to be %v, have %v", want, have)
+			}
+		})
+	}
+}
+
 func (r *testRunner) testReadBodyRequest() {
 	hostFn := handler.FuncReadBody
 
@@ -356,6 +581,138 @@ func (r *testRunner) testReadBodyRequest() {
 	}
 }
 
+func (r *testRunner) testPeekBodyRequest() {
+	hostFn := handler.FuncPeekBody
+
+	testID := fmt.Sprintf("%s/request", hostFn)
+	r.t.Run(testID, func(t *testing.T) {
+		req, err := http.NewRequest("POST", r.url, strings.NewReader("hello world"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("x-httpwasm-tck-testid", testID)
+		resp, err := r.client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		// The backend echoes the request body it read.
+		if want, have := "hello world", checkResponse(t, resp); want != have {
+			t.Errorf("expected body to be %s, have %s", want, have)
+		}
+	})
+}
+
+// testWriteBody ensures the host corrects the length of bodies rewritten by
+// the guest to "hello", when they had a different length.
+func (r *testRunner) testWriteBody() {
+	hostFn := handler.FuncWriteBody
+
+	for _, kind := range []string{"request", "response"} {
+		testID := fmt.Sprintf("%s/%s", hostFn, kind)
+		r.t.Run(testID, func(t *testing.T) {
+			req, err := http.NewRequest("POST", r.url, strings.NewReader(strings.Repeat("a", 100)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("x-httpwasm-tck-testid", testID)
+			resp, err := r.client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			body := checkResponse(t, resp)
+			if want, have := "hello", body; want != have {
+				t.Errorf("expected body to be %s, have %s", want, have)
+			}
+			if resp.ContentLength != -1 && resp.ContentLength != int64(len(body)) {
+				t.Errorf("expected content length to be %d, have %d", len(body), resp.ContentLength)
+			}
+			if kind == "request" {
+				if want, have := "5", resp.Header.Get("x-httpwasm-next-content-length"); want != have {
+					t.Errorf("expected next content length to be %s, have %s", want, have)
+				}
+			}
+		})
+	}
+}
+
+func (r *testRunner) testSendInformational() {
+	hostFn := handler.FuncSendInformational
+	link := "</style.css>; rel=preload; as=style"
+
+	r.t.Run(hostFn, func(t *testing.T) {
+		var codes []int
+		var links []string
+		trace := &httptrace.ClientTrace{Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			codes = append(codes, code)
+			links = append(links, header.Get("Link"))
+			return nil
+		}}
+		ctx := httptrace.WithClientTrace(context.Background(), trace)
+		req, err := http.NewRequestWithContext(ctx, "GET", r.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("x-httpwasm-tck-testid", hostFn)
+		resp, err := r.client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		checkResponse(t, resp)
+		if want, have := []int{http.StatusEarlyHints}, codes; !reflect.DeepEqual(want, have) {
+			t.Errorf("expected 1xx codes to be %v, have %v", want, have)
+		}
+		if want, have := []string{link}, links; !reflect.DeepEqual(want, have) {
+			t.Errorf("expected 1xx links to be %v, have %v", want, have)
+		}
+		if have := resp.Header.Get("Link"); have != "" {
+			t.Errorf("expected no link in the final response, have %s", have)
+		}
+	})
+}
+
+func (r *testRunner) testGetHostError() {
+	hostFn := handler.FuncGetHostError
+
+	r.t.Run(hostFn, func(t *testing.T) {
+		if r.remoteBackend {
+			t.Skip("the backend panic doesn't reach the host")
+		}
+
+		req, err := http.NewRequest("GET", r.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("x-httpwasm-tck-testid", hostFn)
+		req.Header.Set("x-httpwasm-tck-panic", "oops!")
+		resp, err := r.client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		checkResponse(t, resp)
+		if want, have := http.StatusBadGateway, resp.StatusCode; want != have {
+			t.Errorf("expected status code to be %d, have %d", want, have)
+		}
+		if want, have := fmt.Sprint(handler.ErrorKindPanic), resp.Header.Get("x-httpwasm-host-error-kind"); want != have {
+			t.Errorf("expected error kind to be %s, have %s", want, have)
+		}
+		if want, have := "oops!", resp.Header.Get("x-httpwasm-host-error"); want != have {
+			t.Errorf("expected error to be %s, have %s", want, have)
+		}
+	})
+}
+
 func (r *testRunner) testSetHeaderValueRequest() {
 	hostFn := handler.FuncSetHeaderValue
 
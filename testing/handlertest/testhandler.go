@@ -8,6 +8,7 @@ package handlertest
 import (
 	"context"
 	"errors"
+	"net/url"
 	"reflect"
 	"sort"
 	"strings"
@@ -41,12 +42,16 @@ func HostTest(t *testing.T, h handler.Host, newCtx func(handler.Features) (conte
 
 	ht.testMethod()
 	ht.testURI()
+	ht.testAuthority()
 	ht.testProtocolVersion()
 	ht.testRequestHeaders()
+	ht.testQueryCookies()
 	ht.testRequestBody()
 	ht.testRequestTrailers()
 	ht.testStatusCode()
 	ht.testResponseHeaders()
+	ht.testHeaders()
+	ht.testRawHeaders()
 	ht.testResponseBody()
 	ht.testResponseTrailers()
 	ht.testSourceAddr()
@@ -149,6 +154,64 @@ func (h *hostTester) testURI() {
 	})
 }
 
+// testAuthority ensures handler.AuthorityHost, if implemented, is
+// consistent with the "Host" request header and absolute-form URIs.
+func (h *hostTester) testAuthority() {
+	ah, ok := h.h.(handler.AuthorityHost)
+	if !ok {
+		return
+	}
+
+	h.t.Run("SetAuthority", func(t *testing.T) {
+		ctx, _ := h.newCtx(0) // no features required
+
+		ah.SetAuthority(ctx, "example.com:8080")
+
+		if want, have := "example.com:8080", ah.GetAuthority(ctx); want != have {
+			t.Errorf("unexpected authority, want: %v, have: %v", want, have)
+		}
+		if want, have := []string{"example.com:8080"}, h.h.GetRequestHeaderValues(ctx, "Host"); !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected host header, want: %v, have: %v", want, have)
+		}
+	})
+
+	h.t.Run("SetRequestHeaderValue Host", func(t *testing.T) {
+		ctx, _ := h.newCtx(0) // no features required
+
+		h.h.SetRequestHeaderValue(ctx, "host", "example.com")
+
+		if want, have := "example.com", ah.GetAuthority(ctx); want != have {
+			t.Errorf("unexpected authority, want: %v, have: %v", want, have)
+		}
+	})
+
+	h.t.Run("SetScheme", func(t *testing.T) {
+		ctx, _ := h.newCtx(0) // no features required
+
+		ah.SetScheme(ctx, "https")
+
+		if want, have := "https", ah.GetScheme(ctx); want != have {
+			t.Errorf("unexpected scheme, want: %v, have: %v", want, have)
+		}
+	})
+
+	h.t.Run("SetURI absolute-form", func(t *testing.T) {
+		ctx, _ := h.newCtx(0) // no features required
+
+		h.h.SetURI(ctx, "https://example.com/a%20b?q=go+language")
+
+		if want, have := "https", ah.GetScheme(ctx); want != have {
+			t.Errorf("unexpected scheme, want: %v, have: %v", want, have)
+		}
+		if want, have := "example.com", ah.GetAuthority(ctx); want != have {
+			t.Errorf("unexpected authority, want: %v, have: %v", want, have)
+		}
+		if want, have := "/a%20b?q=go+language", h.h.GetURI(ctx); want != have {
+			t.Errorf("unexpected URI, want: %v, have: %v", want, have)
+		}
+	})
+}
+
 func (h *hostTester) testProtocolVersion() {
 	ctx, _ := h.newCtx(0) // no features required
 
@@ -167,6 +230,105 @@ func (h *hostTester) testRequestHeaders() {
 	h.testRemoveRequestHeaderValue()
 }
 
+// testQueryCookies ensures handler.QueryCookiesHost, if implemented, is
+// consistent with the URI and "Cookie" request header.
+func (h *hostTester) testQueryCookies() {
+	qh, ok := h.h.(handler.QueryCookiesHost)
+	if !ok {
+		return
+	}
+
+	h.t.Run("GetQueryValues default", func(t *testing.T) {
+		ctx, _ := h.newCtx(handler.FeatureQueryCookies)
+		if have := qh.GetQueryValues(ctx, "tag"); have != nil {
+			t.Errorf("unexpected default query values, want: nil, have: %v", have)
+		}
+	})
+
+	h.t.Run("SetQueryValue", func(t *testing.T) {
+		ctx, _ := h.newCtx(handler.FeatureQueryCookies)
+		h.h.SetURI(ctx, "/a?x=1&tag=a&tag=b%20c")
+
+		if want, have := []string{"a", "b c"}, qh.GetQueryValues(ctx, "tag"); !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected query values, want: %v, have: %v", want, have)
+		}
+
+		qh.SetQueryValue(ctx, "tag", "d&e")
+
+		if want, have := []string{"d&e"}, qh.GetQueryValues(ctx, "tag"); !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected query values, want: %v, have: %v", want, have)
+		}
+		if want, have := (url.Values{"x": {"1"}, "tag": {"d&e"}}), uriQuery(t, h.h.GetURI(ctx)); !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected URI query, want: %v, have: %v", want, have)
+		}
+	})
+
+	h.t.Run("RemoveQuery", func(t *testing.T) {
+		ctx, _ := h.newCtx(handler.FeatureQueryCookies)
+		h.h.SetURI(ctx, "/a?x=1&tag=a&tag=b")
+
+		qh.RemoveQuery(ctx, "tag")
+
+		if have := qh.GetQueryValues(ctx, "tag"); have != nil {
+			t.Errorf("unexpected query values, want: nil, have: %v", have)
+		}
+		if want, have := (url.Values{"x": {"1"}}), uriQuery(t, h.h.GetURI(ctx)); !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected URI query, want: %v, have: %v", want, have)
+		}
+	})
+
+	h.t.Run("GetCookieValues default", func(t *testing.T) {
+		ctx, _ := h.newCtx(handler.FeatureQueryCookies)
+		if have := qh.GetCookieValues(ctx, "a"); have != nil {
+			t.Errorf("unexpected default cookie values, want: nil, have: %v", have)
+		}
+	})
+
+	h.t.Run("SetCookieValue", func(t *testing.T) {
+		ctx, _ := h.newCtx(handler.FeatureQueryCookies)
+		h.h.SetRequestHeaderValue(ctx, "Cookie", "a=b; c=d")
+
+		if want, have := []string{"d"}, qh.GetCookieValues(ctx, "c"); !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected cookie values, want: %v, have: %v", want, have)
+		}
+
+		qh.SetCookieValue(ctx, "c", "e")
+		qh.SetCookieValue(ctx, "f", "g")
+
+		if want, have := []string{"e"}, qh.GetCookieValues(ctx, "c"); !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected cookie values, want: %v, have: %v", want, have)
+		}
+		if want, have := []string{"b"}, qh.GetCookieValues(ctx, "a"); !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected cookie values, want: %v, have: %v", want, have)
+		}
+		if want, have := []string{"g"}, qh.GetCookieValues(ctx, "f"); !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected cookie values, want: %v, have: %v", want, have)
+		}
+	})
+
+	h.t.Run("RemoveCookie", func(t *testing.T) {
+		ctx, _ := h.newCtx(handler.FeatureQueryCookies)
+		h.h.SetRequestHeaderValue(ctx, "Cookie", "a=b")
+
+		qh.RemoveCookie(ctx, "a")
+
+		if have := qh.GetCookieValues(ctx, "a"); have != nil {
+			t.Errorf("unexpected cookie values, want: nil, have: %v", have)
+		}
+	})
+}
+
+// uriQuery returns the parsed query of a URI returned by handler.Host GetURI.
+func uriQuery(t *testing.T, uri string) url.Values {
+	t.Helper()
+	_, rawQuery, _ := strings.Cut(uri, "?")
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
 func (h *hostTester) addTestRequestHeaders(ctx context.Context) {
 	for k, vs := range testRequestHeaders {
 		h.h.SetRequestHeaderValue(ctx, k, vs[0])
@@ -436,6 +598,92 @@ func (h *hostTester) testResponseHeaders() {
 	h.testRemoveResponseHeaderValue()
 }
 
+// testHeaders ensures handler.HeadersHost, if implemented, is consistent
+// with the names and values functions of handler.Host.
+func (h *hostTester) testHeaders() {
+	hh, ok := h.h.(handler.HeadersHost)
+	if !ok {
+		return
+	}
+
+	ctx, _ := h.newCtx(0) // no features required
+
+	h.t.Run("GetHeaders default", func(t *testing.T) {
+		if have := hh.GetHeaders(ctx, handler.HeaderKindResponse); have != nil {
+			t.Errorf("unexpected default response headers, want: nil, have: %v", have)
+		}
+	})
+
+	h.t.Run("GetHeaders", func(t *testing.T) {
+		h.addTestRequestHeaders(ctx)
+		h.addTestResponseHeaders(ctx)
+
+		for _, tc := range []struct {
+			kind   handler.HeaderKind
+			names  func(context.Context) []string
+			values func(context.Context, string) []string
+		}{
+			{handler.HeaderKindRequest, h.h.GetRequestHeaderNames, h.h.GetRequestHeaderValues},
+			{handler.HeaderKindResponse, h.h.GetResponseHeaderNames, h.h.GetResponseHeaderValues},
+		} {
+			var want []string
+			for _, n := range tc.names(ctx) {
+				for _, v := range tc.values(ctx, n) {
+					want = append(want, n, v)
+				}
+			}
+
+			if have := hh.GetHeaders(ctx, tc.kind); !reflect.DeepEqual(want, have) {
+				t.Errorf("unexpected headers of kind %d, want: %v, have: %v", tc.kind, want, have)
+			}
+		}
+	})
+}
+
+// testRawHeaders ensures a host that supports handler.FeatureRawHeaders
+// returns names in the order they were added, with their original casing.
+func (h *hostTester) testRawHeaders() {
+	ctx, enabled := h.newCtx(handler.FeatureRawHeaders)
+	if !enabled.IsEnabled(handler.FeatureRawHeaders) {
+		return // unsupported
+	}
+
+	want := []string{"X-Zed", "content-type", "Accept", "x-B3-TraceId"}
+
+	h.t.Run("GetRequestHeaderNames raw", func(t *testing.T) {
+		for _, n := range want {
+			h.h.AddRequestHeaderValue(ctx, n, "1")
+		}
+		if have := h.h.GetRequestHeaderNames(ctx); !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected header names, want: %v, have: %v", want, have)
+		}
+	})
+
+	h.t.Run("GetResponseHeaderNames raw", func(t *testing.T) {
+		for _, n := range want {
+			h.h.AddResponseHeaderValue(ctx, n, "1")
+		}
+		if have := h.h.GetResponseHeaderNames(ctx); !reflect.DeepEqual(want, have) {
+			t.Errorf("unexpected header names, want: %v, have: %v", want, have)
+		}
+	})
+
+	hh, ok := h.h.(handler.HeadersHost)
+	if !ok {
+		return
+	}
+
+	h.t.Run("GetHeaders raw", func(t *testing.T) {
+		var wantFields []string
+		for _, n := range want {
+			wantFields = append(wantFields, n, "1")
+		}
+		if have := hh.GetHeaders(ctx, handler.HeaderKindRequest); !reflect.DeepEqual(wantFields, have) {
+			t.Errorf("unexpected headers, want: %v, have: %v", wantFields, have)
+		}
+	})
+}
+
 func (h *hostTester) addTestResponseHeaders(ctx context.Context) {
 	for k, vs := range testResponseHeaders {
 		h.h.SetResponseHeaderValue(ctx, k, vs[0])
@@ -0,0 +1,247 @@
+// Package verify checks signatures of guest wasm before it is compiled, for
+// example when guests are loaded from a shared artifact store.
+//
+// Signatures are either detached, such as from a file next to the guest, or
+// embedded in a custom section of the guest named SectionName. Both sign the
+// guest bytes, without any embedded signature.
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// SectionName is the name of the custom section holding an embedded
+// signature. It must be the last section of the guest.
+const SectionName = "http-wasm.signature"
+
+// Verifier checks the guest bytes before they are compiled.
+type Verifier interface {
+	// Verify returns a *SignatureError if the guest isn't signed by a
+	// trusted key.
+	Verify(guest []byte) error
+}
+
+// SignatureError is returned when a guest fails verification.
+type SignatureError struct {
+	// Unsigned is true when the guest has no signature, as opposed to one
+	// that doesn't match any trusted key.
+	Unsigned bool
+
+	// Err is the cause, if any.
+	Err error
+}
+
+// Error implements error
+func (e *SignatureError) Error() string {
+	switch {
+	case e.Unsigned:
+		return "verify: guest is unsigned"
+	case e.Err != nil:
+		return fmt.Sprintf("verify: invalid signature: %v", e.Err)
+	default:
+		return "verify: invalid signature"
+	}
+}
+
+// Unwrap returns the cause, if any.
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+// Detached returns a Verifier of a signature over the guest bytes, by any of
+// the keys. An empty signature fails as unsigned.
+//
+// Keys are ed25519.PublicKey or *ecdsa.PublicKey. ECDSA signatures are ASN.1
+// encoded, over the SHA-256, SHA-384 or SHA-512 digest of the guest for the
+// P-256, P-384 or P-521 curve respectively.
+func Detached(signature []byte, keys ...crypto.PublicKey) (Verifier, error) {
+	if err := checkKeys(keys); err != nil {
+		return nil, err
+	}
+	return &detached{signature: signature, keys: keys}, nil
+}
+
+type detached struct {
+	signature []byte
+	keys      []crypto.PublicKey
+}
+
+// Verify implements Verifier.Verify
+func (v *detached) Verify(guest []byte) error {
+	return verify(guest, v.signature, v.keys)
+}
+
+// Embedded returns a Verifier of a signature embedded in the guest, by any of
+// the keys. A guest without a SectionName section fails as unsigned.
+//
+// See Detached for the supported keys.
+func Embedded(keys ...crypto.PublicKey) (Verifier, error) {
+	if err := checkKeys(keys); err != nil {
+		return nil, err
+	}
+	return &embedded{keys: keys}, nil
+}
+
+type embedded struct {
+	keys []crypto.PublicKey
+}
+
+// Verify implements Verifier.Verify
+func (v *embedded) Verify(guest []byte) error {
+	unsigned, signature, err := splitSignature(guest)
+	if err != nil {
+		return &SignatureError{Err: err}
+	}
+	return verify(unsigned, signature, v.keys)
+}
+
+// Embed returns the guest with the signature embedded in a custom section
+// named SectionName.
+func Embed(guest, signature []byte) []byte {
+	var content []byte
+	content = appendUleb128(content, uint32(len(SectionName)))
+	content = append(content, SectionName...)
+	content = append(content, signature...)
+
+	signed := append([]byte{}, guest...)
+	signed = append(signed, 0) // custom section ID
+	signed = appendUleb128(signed, uint32(len(content)))
+	return append(signed, content...)
+}
+
+// ParsePublicKey parses a PEM encoded PKIX public key, such as one created
+// by "openssl pkey -pubout".
+func ParsePublicKey(pemBytes []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("verify: invalid PEM")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("verify: invalid public key: %w", err)
+	}
+	if err = checkKeys([]crypto.PublicKey{key}); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func checkKeys(keys []crypto.PublicKey) error {
+	if len(keys) == 0 {
+		return errors.New("verify: no keys")
+	}
+	for _, key := range keys {
+		switch key.(type) {
+		case ed25519.PublicKey, *ecdsa.PublicKey:
+		default:
+			return fmt.Errorf("verify: unsupported key type %T", key)
+		}
+	}
+	return nil
+}
+
+// verify returns nil if any of the keys signed the message.
+func verify(message, signature []byte, keys []crypto.PublicKey) error {
+	if len(signature) == 0 {
+		return &SignatureError{Unsigned: true}
+	}
+	for _, key := range keys {
+		switch key := key.(type) {
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, message, signature) {
+				return nil
+			}
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(key, digest(key.Curve, message), signature) {
+				return nil
+			}
+		}
+	}
+	return &SignatureError{}
+}
+
+// digest returns the hash of the message conventionally used with the curve.
+func digest(curve elliptic.Curve, message []byte) []byte {
+	switch curve.Params().BitSize {
+	case 384:
+		sum := sha512.Sum384(message)
+		return sum[:]
+	case 521:
+		sum := sha512.Sum512(message)
+		return sum[:]
+	default:
+		sum := sha256.Sum256(message)
+		return sum[:]
+	}
+}
+
+var wasmMagic = []byte{0x00, 0x61, 0x73, 0x6d}
+
+// splitSignature returns the guest without any SectionName section, and the
+// signature it held.
+func splitSignature(guest []byte) (unsigned, signature []byte, err error) {
+	if len(guest) < 8 || !bytes.Equal(guest[:4], wasmMagic) {
+		return nil, nil, errors.New("invalid wasm binary")
+	}
+
+	for pos := 8; pos < len(guest); {
+		start := pos
+		id := guest[pos]
+		pos++
+		size, n := uleb128(guest[pos:])
+		if n == 0 || uint64(pos+n)+uint64(size) > uint64(len(guest)) {
+			return nil, nil, errors.New("invalid section")
+		}
+		pos += n
+		end := pos + int(size)
+
+		if id == 0 { // custom section
+			nameLen, n := uleb128(guest[pos:end])
+			if n != 0 && uint64(pos+n)+uint64(nameLen) <= uint64(end) &&
+				string(guest[pos+n:pos+n+int(nameLen)]) == SectionName {
+				if end != len(guest) {
+					return nil, nil, fmt.Errorf("%s isn't the last section", SectionName)
+				}
+				return guest[:start], guest[pos+n+int(nameLen) : end], nil
+			}
+		}
+		pos = end
+	}
+	return guest, nil, nil
+}
+
+// uleb128 decodes an unsigned LEB128 uint32, returning zero bytes read if
+// invalid.
+func uleb128(b []byte) (v uint32, n int) {
+	for shift := 0; n < len(b) && n < 5; shift += 7 {
+		c := b[n]
+		n++
+		v |= uint32(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, n
+		}
+	}
+	return 0, 0
+}
+
+func appendUleb128(b []byte, v uint32) []byte {
+	for {
+		c := byte(v & 0x7f)
+		v >>= 7
+		if v != 0 {
+			b = append(b, c|0x80)
+			continue
+		}
+		return append(b, c)
+	}
+}
@@ -0,0 +1,166 @@
+package verify
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/http-wasm/http-wasm-host-go/internal/test"
+)
+
+func TestVerify(t *testing.T) {
+	guest := test.BinE2EMethod
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edSig := ed25519.Sign(edPriv, guest)
+	ecSig, err := ecdsa.SignASN1(rand.Reader, ecPriv, digest(elliptic.P256(), guest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, guest...)
+	tampered[len(tampered)-1]++
+
+	detachedVerifier := func(signature []byte, keys ...crypto.PublicKey) Verifier {
+		v, err := Detached(signature, keys...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	embeddedVerifier, err := Embedded(otherPub, &ecPriv.PublicKey, edPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name             string
+		verifier         Verifier
+		guest            []byte
+		expectedUnsigned bool
+		expectedInvalid  bool
+	}{
+		{
+			name:     "detached ed25519",
+			verifier: detachedVerifier(edSig, edPub),
+			guest:    guest,
+		},
+		{
+			name:     "detached ecdsa",
+			verifier: detachedVerifier(ecSig, &ecPriv.PublicKey),
+			guest:    guest,
+		},
+		{
+			name:     "detached rotated key",
+			verifier: detachedVerifier(edSig, otherPub, edPub),
+			guest:    guest,
+		},
+		{
+			name:            "detached wrong key",
+			verifier:        detachedVerifier(edSig, otherPub),
+			guest:           guest,
+			expectedInvalid: true,
+		},
+		{
+			name:            "detached tampered",
+			verifier:        detachedVerifier(edSig, edPub),
+			guest:           tampered,
+			expectedInvalid: true,
+		},
+		{
+			name:             "detached unsigned",
+			verifier:         detachedVerifier(nil, edPub),
+			guest:            guest,
+			expectedUnsigned: true,
+		},
+		{
+			name:     "embedded ed25519",
+			verifier: embeddedVerifier,
+			guest:    Embed(guest, edSig),
+		},
+		{
+			name:     "embedded ecdsa",
+			verifier: embeddedVerifier,
+			guest:    Embed(guest, ecSig),
+		},
+		{
+			name:            "embedded tampered",
+			verifier:        embeddedVerifier,
+			guest:           Embed(tampered, edSig),
+			expectedInvalid: true,
+		},
+		{
+			name:            "embedded not last",
+			verifier:        embeddedVerifier,
+			guest:           append(Embed(guest, edSig), 0, 1, 0), // empty custom section
+			expectedInvalid: true,
+		},
+		{
+			name:             "embedded unsigned",
+			verifier:         embeddedVerifier,
+			guest:            guest,
+			expectedUnsigned: true,
+		},
+	}
+
+	for _, tt := range tests {
+		tc := tt
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.verifier.Verify(tc.guest)
+			if !tc.expectedUnsigned && !tc.expectedInvalid {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			var sigErr *SignatureError
+			if !errors.As(err, &sigErr) {
+				t.Fatalf("expected SignatureError, have: %v", err)
+			}
+			if want, have := tc.expectedUnsigned, sigErr.Unsigned; want != have {
+				t.Errorf("unexpected unsigned, want: %v, have: %v (%v)", want, have, err)
+			}
+		})
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ParsePublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pub.Equal(key) {
+		t.Errorf("unexpected key: %v", key)
+	}
+
+	if _, err = ParsePublicKey([]byte("not pem")); err == nil {
+		t.Error("expected error parsing invalid PEM")
+	}
+}